@@ -1,6 +1,9 @@
 package main
 
 import (
+	"github.com/caturandi-labs/go-social/internal/auth"
+	"github.com/caturandi-labs/go-social/internal/blob"
+	"github.com/caturandi-labs/go-social/internal/mailer"
 	"github.com/caturandi-labs/go-social/internal/store"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -10,8 +13,13 @@ import (
 )
 
 type application struct {
-	config config
-	store  store.Storage
+	config        config
+	store         store.Storage
+	authenticator auth.Authenticator
+	mailer        mailer.Client
+	blob          blob.Store
+	// mediaQueue wakes the media worker when new uploads arrive.
+	mediaQueue chan struct{}
 }
 
 type dbConfig struct {
@@ -21,10 +29,67 @@ type dbConfig struct {
 	maxIdleTime  string
 }
 
+type authConfig struct {
+	token tokenConfig
+}
+
+type tokenConfig struct {
+	secret string
+	exp    time.Duration
+	iss    string
+}
+
+type mailConfig struct {
+	exp       time.Duration
+	backend   string
+	fromEmail string
+	dir       string
+	smtp      smtpConfig
+}
+
+type smtpConfig struct {
+	host     string
+	port     int
+	username string
+	password string
+}
+
+type blobConfig struct {
+	backend string
+	dir     string
+	baseURL string
+	s3      s3Config
+}
+
+type s3Config struct {
+	endpoint  string
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	useSSL    bool
+	publicURL string
+}
+
+type postsConfig struct {
+	// restoreWindow is how long a deleted post can be restored, retention
+	// how long it is kept before the purger removes it for good.
+	restoreWindow time.Duration
+	retention     time.Duration
+	purgeInterval time.Duration
+	// publishInterval is how often due scheduled posts are published.
+	publishInterval time.Duration
+}
+
 type config struct {
-	addr string
-	db   dbConfig
-	env  string
+	addr        string
+	db          dbConfig
+	env         string
+	auth        authConfig
+	mail        mailConfig
+	blob        blobConfig
+	posts       postsConfig
+	frontendURL string
 }
 
 func (app *application) mount() *chi.Mux {
@@ -40,23 +105,89 @@ func (app *application) mount() *chi.Mux {
 		r.Get("/health", app.healthCheckHandler)
 
 		r.Route("/posts", func(r chi.Router) {
-			r.Post("/", app.createPostHandler)
+			r.With(app.AuthTokenMiddleware).Post("/", app.createPostHandler)
+			r.With(app.AuthTokenMiddleware, app.deletedPostContextMiddleware).Post("/{id}/restore", app.checkPostOwnership("admin", app.restorePostHandler))
 			r.Route("/{id}", func(r chi.Router) {
+				r.Use(app.OptionalAuthTokenMiddleware)
 				r.Use(app.postsContextMiddleware)
 				r.Get("/", app.getPostHandler)
-				r.Patch("/", app.updatePostHandler)
-				r.Delete("/", app.deletePostHandler)
+				r.With(app.AuthTokenMiddleware).Patch("/", app.checkPostOwnership("moderator", app.updatePostHandler))
+				r.With(app.AuthTokenMiddleware).Delete("/", app.checkPostOwnership("admin", app.deletePostHandler))
+				r.With(app.AuthTokenMiddleware).Put("/like", app.likePostHandler)
+				r.With(app.AuthTokenMiddleware).Delete("/like", app.unlikePostHandler)
+				r.With(app.AuthTokenMiddleware).Put("/bookmark", app.bookmarkPostHandler)
+				r.With(app.AuthTokenMiddleware).Delete("/bookmark", app.unbookmarkPostHandler)
+				r.With(app.AuthTokenMiddleware).Put("/repost", app.repostHandler)
+				r.With(app.AuthTokenMiddleware).Delete("/repost", app.unrepostHandler)
+				r.Get("/revisions", app.getPostRevisionsHandler)
+				r.Get("/revisions/diff", app.getPostRevisionDiffHandler)
+				r.Get("/revisions/{version}", app.getPostRevisionHandler)
+
+				r.Route("/comments", func(r chi.Router) {
+					r.Get("/", app.listCommentsHandler)
+					r.With(app.AuthTokenMiddleware).Post("/", app.createCommentHandler)
+					r.Route("/{commentID}", func(r chi.Router) {
+						r.Use(app.commentsContextMiddleware)
+						r.Get("/", app.getCommentHandler)
+						r.With(app.AuthTokenMiddleware).Patch("/", app.checkCommentOwnership("", app.updateCommentHandler))
+						r.With(app.AuthTokenMiddleware).Delete("/", app.checkCommentOwnership("moderator", app.deleteCommentHandler))
+						r.With(app.AuthTokenMiddleware).Post("/replies", app.createCommentReplyHandler)
+					})
+				})
 			})
 		})
 
 		r.Route("/users", func(r chi.Router) {
+			r.Put("/activate/{token}", app.activateUserHandler)
+			r.With(app.AuthTokenMiddleware).Get("/feed", app.getUserFeedHandler)
+			r.With(app.OptionalAuthTokenMiddleware, app.usernameContextMiddleware, app.unblockedUserMiddleware).Get("/by-username/{username}", app.getUserHandler)
+
+			r.Route("/me", func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware)
+
+				r.Patch("/", app.updateMeHandler)
+				r.Put("/privacy", app.updatePrivacyHandler)
+				r.Get("/follow-requests", app.getFollowRequestsHandler)
+				r.Put("/follow-requests/{requesterID}/approve", app.approveFollowRequestHandler)
+				r.Put("/follow-requests/{requesterID}/reject", app.rejectFollowRequestHandler)
+				r.Get("/drafts", app.getDraftsHandler)
+				r.Get("/bookmarks", app.getBookmarksHandler)
+				r.Get("/bookmark-folders", app.getBookmarkFoldersHandler)
+				r.Post("/bookmark-folders", app.createBookmarkFolderHandler)
+				r.Delete("/bookmark-folders/{folderID}", app.deleteBookmarkFolderHandler)
+			})
+
 			r.Route("/{userID}", func(r chi.Router) {
-				r.Get("/", app.getUserHandler)
-				r.Put("/follow", app.followUserHandler)
-				r.Put("/unfollow", app.unFollowUserHandler)
+				r.Use(app.OptionalAuthTokenMiddleware)
+				r.Use(app.userContextMiddleware)
+
+				r.With(app.unblockedUserMiddleware).Get("/", app.getUserHandler)
+				r.With(app.unblockedUserMiddleware).Get("/followers", app.getUserFollowersHandler)
+				r.With(app.unblockedUserMiddleware).Get("/following", app.getUserFollowingHandler)
+				r.With(app.AuthTokenMiddleware).Put("/follow", app.followUserHandler)
+				r.With(app.AuthTokenMiddleware).Put("/unfollow", app.unFollowUserHandler)
+				r.With(app.AuthTokenMiddleware).Post("/block", app.blockUserHandler)
+				r.With(app.AuthTokenMiddleware).Delete("/block", app.unblockUserHandler)
+				r.With(app.AuthTokenMiddleware).Post("/mute", app.muteUserHandler)
+				r.With(app.AuthTokenMiddleware).Delete("/mute", app.unmuteUserHandler)
 			})
 		})
 
+		r.Route("/media", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+
+			r.Post("/", app.uploadMediaHandler)
+			r.Get("/{id}", app.getMediaHandler)
+		})
+		if files, ok := app.blob.(http.Handler); ok {
+			r.Handle("/files/*", http.StripPrefix("/v1/files", publicFiles(files)))
+		}
+
+		r.Route("/authentication", func(r chi.Router) {
+			r.Post("/user", app.registerUserHandler)
+			r.Post("/token", app.createTokenHandler)
+		})
+
 	})
 
 	return r
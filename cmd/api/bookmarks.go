@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/caturandi-labs/go-social/internal/store"
+	"github.com/go-chi/chi/v5"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+type BookmarkPostPayload struct {
+	FolderID *int64 `json:"folder_id"`
+}
+
+// bookmarkPostHandler saves the post in the URL for the authenticated user.
+// The body is optional; sending a folder_id files the bookmark into that
+// folder, also when the post was already bookmarked.
+func (app *application) bookmarkPostHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromContext(r)
+	post := getPostFromContext(r)
+
+	// an empty body, chunked or not, files the bookmark outside of any folder
+	var payload BookmarkPostPayload
+	if err := readJSON(w, r, &payload); err != nil && !errors.Is(err, io.EOF) {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	bookmark, err := app.store.Bookmarks.Save(r.Context(), user.ID, post.ID, payload.FolderID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrUnknownFolder):
+			app.unprocessableEntityResponse(w, r, map[string]string{"folder_id": "Unknown folder"})
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, bookmark); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) unbookmarkPostHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromContext(r)
+	post := getPostFromContext(r)
+
+	if err := app.store.Bookmarks.Remove(r.Context(), user.ID, post.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	_ = app.jsonResponse(w, http.StatusNoContent, nil)
+}
+
+// getBookmarksHandler lists the bookmarks of the authenticated user,
+// optionally limited to the folder given in the folder_id query parameter.
+func (app *application) getBookmarksHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromContext(r)
+
+	q := store.PaginatedQuery{
+		Limit: 20,
+		Sort:  "desc",
+	}
+
+	q, err := q.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(q); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var folderID *int64
+	if param := r.URL.Query().Get("folder_id"); param != "" {
+		id, err := strconv.ParseInt(param, 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, fmt.Errorf("invalid folder_id %q", param))
+			return
+		}
+		folderID = &id
+	}
+
+	bookmarks, pagination, err := app.store.Bookmarks.List(r.Context(), user.ID, folderID, q)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.paginatedJSONResponse(w, http.StatusOK, bookmarks, pagination); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) getBookmarkFoldersHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromContext(r)
+
+	folders, err := app.store.Bookmarks.GetFolders(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, folders); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+type CreateBookmarkFolderPayload struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+func (app *application) createBookmarkFolderHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateBookmarkFolderPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.unprocessableEntityResponse(w, r, formatValidationErrors(err))
+		return
+	}
+
+	user := getAuthUserFromContext(r)
+	folder := &store.BookmarkFolder{
+		UserID: user.ID,
+		Name:   payload.Name,
+	}
+
+	if err := app.store.Bookmarks.CreateFolder(r.Context(), folder); err != nil {
+		switch {
+		case errors.Is(err, store.ErrConflict):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, folder); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) deleteBookmarkFolderHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromContext(r)
+
+	folderID, err := strconv.ParseInt(chi.URLParam(r, "folderID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.Bookmarks.DeleteFolder(r.Context(), user.ID, folderID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	_ = app.jsonResponse(w, http.StatusNoContent, nil)
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/caturandi-labs/go-social/internal/store"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strconv"
+)
+
+type commentKey string
+
+const commentCtxKey commentKey = "comment"
+
+func (app *application) listCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromContext(r)
+
+	q := store.PaginatedQuery{
+		Limit: 20,
+		Sort:  "desc",
+	}
+
+	q, err := q.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(q); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	comments, pagination, err := app.store.Comments.ListByPostID(r.Context(), post.ID, viewerID(r), q)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.paginatedJSONResponse(w, http.StatusOK, comments, pagination); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+type CreateCommentPayload struct {
+	Content string `json:"content" validate:"required,max=1000"`
+}
+
+func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromContext(r)
+	user := getAuthUserFromContext(r)
+
+	var payload CreateCommentPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		validationErr := formatValidationErrors(err)
+		app.unprocessableEntityResponse(w, r, validationErr)
+		return
+	}
+
+	comment := &store.Comment{
+		PostID:  post.ID,
+		UserID:  user.ID,
+		Content: payload.Content,
+		User:    *user,
+	}
+
+	if err := app.store.Comments.Create(r.Context(), comment); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		case errors.Is(err, store.ErrBlocked):
+			app.forbiddenResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, comment); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) getCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromContext(r)
+
+	if err := app.jsonResponse(w, http.StatusOK, comment); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+type UpdateCommentPayload struct {
+	Content string `json:"content" validate:"required,max=1000"`
+}
+
+func (app *application) updateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromContext(r)
+
+	var payload UpdateCommentPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		validationErr := formatValidationErrors(err)
+		app.unprocessableEntityResponse(w, r, validationErr)
+		return
+	}
+
+	comment.Content = payload.Content
+
+	if err := app.store.Comments.Update(r.Context(), comment); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, comment); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromContext(r)
+
+	if err := app.store.Comments.Delete(r.Context(), comment.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	_ = app.jsonResponse(w, http.StatusNoContent, nil)
+}
+
+func (app *application) createCommentReplyHandler(w http.ResponseWriter, r *http.Request) {
+	parent := getCommentFromContext(r)
+	user := getAuthUserFromContext(r)
+
+	var payload CreateCommentPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		validationErr := formatValidationErrors(err)
+		app.unprocessableEntityResponse(w, r, validationErr)
+		return
+	}
+
+	if parent.Deleted {
+		app.unprocessableEntityResponse(w, r, map[string]string{"parent_id": "Cannot reply to a deleted comment"})
+		return
+	}
+
+	if parent.Depth >= store.MaxCommentDepth {
+		app.unprocessableEntityResponse(w, r, map[string]string{"parent_id": fmt.Sprintf("Replies cannot be nested deeper than %d levels", store.MaxCommentDepth)})
+		return
+	}
+
+	comment := &store.Comment{
+		PostID:   parent.PostID,
+		UserID:   user.ID,
+		ParentID: &parent.ID,
+		Content:  payload.Content,
+		User:     *user,
+	}
+
+	if err := app.store.Comments.Create(r.Context(), comment); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		case errors.Is(err, store.ErrBlocked):
+			app.forbiddenResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, comment); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// commentsContextMiddleware loads the comment named in the URL. Comments that
+// belong to a different post than the one in the URL are reported as missing.
+func (app *application) commentsContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		post := getPostFromContext(r)
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "commentID"), 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+		comment, err := app.store.Comments.GetByID(ctx, id, viewerID(r))
+		if err == nil && comment.PostID != post.ID {
+			err = store.ErrNotFound
+		}
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		ctx = context.WithValue(ctx, commentCtxKey, comment)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getCommentFromContext(r *http.Request) *store.Comment {
+	comment, _ := r.Context().Value(commentCtxKey).(*store.Comment)
+	return comment
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"github.com/caturandi-labs/go-social/internal/store"
+	"net/http"
+)
+
+// getDraftsHandler lists the draft and scheduled posts of the authenticated
+// user.
+func (app *application) getDraftsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromContext(r)
+
+	q := store.PaginatedQuery{
+		Limit: 20,
+		Sort:  "desc",
+	}
+
+	q, err := q.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(q); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	drafts, pagination, err := app.store.Posts.GetDrafts(r.Context(), user.ID, q)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.paginatedJSONResponse(w, http.StatusOK, drafts, pagination); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
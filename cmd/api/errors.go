@@ -29,3 +29,19 @@ func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request,
 	log.Printf("Not Found Error :%s path: %s error: %s", r.Method, r.URL.Path, err)
 	_ = writeJSONError(w, http.StatusNotFound, "Not Found Error")
 }
+
+func (app *application) unauthorizedResponse(w http.ResponseWriter, r *http.Request, err error) {
+	log.Printf("Unauthorized Error :%s path: %s error: %s", r.Method, r.URL.Path, err)
+	w.Header().Set("WWW-Authenticate", `Bearer realm="restricted"`)
+	_ = writeJSONError(w, http.StatusUnauthorized, "Unauthorized Error")
+}
+
+func (app *application) forbiddenResponse(w http.ResponseWriter, r *http.Request, err error) {
+	log.Printf("Forbidden Error :%s path: %s error: %s", r.Method, r.URL.Path, err)
+	_ = writeJSONError(w, http.StatusForbidden, "Forbidden Error")
+}
+
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request, err error) {
+	log.Printf("Precondition Failed Error :%s path: %s error: %s", r.Method, r.URL.Path, err)
+	_ = writeJSONError(w, http.StatusPreconditionFailed, "Precondition Failed Error")
+}
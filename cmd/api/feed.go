@@ -24,15 +24,16 @@ func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	user := getAuthUserFromContext(r)
 	ctx := r.Context()
 
-	feeds, err := app.store.Posts.GetUserFeed(ctx, int64(1), fq)
+	feeds, pagination, err := app.store.Posts.GetUserFeed(ctx, user.ID, fq)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
-	if err := app.jsonResponse(w, http.StatusOK, feeds); err != nil {
+	if err := app.paginatedJSONResponse(w, http.StatusOK, feeds, pagination); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
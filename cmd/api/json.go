@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/caturandi-labs/go-social/internal/store"
 	"github.com/go-playground/validator/v10"
 	"net/http"
 	"strings"
@@ -70,6 +71,15 @@ func (app *application) jsonResponse(w http.ResponseWriter, status int, data any
 	return writeJSON(w, status, &envelope{Data: data})
 }
 
+func (app *application) paginatedJSONResponse(w http.ResponseWriter, status int, data any, pagination store.Pagination) error {
+	type envelope struct {
+		Data       any              `json:"data"`
+		Pagination store.Pagination `json:"pagination"`
+	}
+
+	return writeJSON(w, status, &envelope{Data: data, Pagination: pagination})
+}
+
 func formatValidationErrors(err error) map[string]string {
 	errFields := make(map[string]string)
 	var validationErrs validator.ValidationErrors
@@ -81,6 +91,8 @@ func formatValidationErrors(err error) map[string]string {
 				errFields[errField] = fmt.Sprintf("%s is required", errField)
 			case "email":
 				errFields[errField] = "Invalid email format"
+			case "url", "http_url":
+				errFields[errField] = "Invalid URL"
 			case "min":
 				errFields[errField] = fmt.Sprintf("%s must be greater than %v characters", errField, err.Param())
 			case "max":
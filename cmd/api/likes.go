@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/caturandi-labs/go-social/internal/store"
+	"net/http"
+)
+
+func (app *application) likePostHandler(w http.ResponseWriter, r *http.Request) {
+	app.updateLike(w, r, app.store.Likes.Like)
+}
+
+func (app *application) unlikePostHandler(w http.ResponseWriter, r *http.Request) {
+	app.updateLike(w, r, app.store.Likes.Unlike)
+}
+
+// updateLike applies a like change from the authenticated user to the post in
+// the URL and responds with the resulting like state. Both operations are
+// idempotent.
+func (app *application) updateLike(w http.ResponseWriter, r *http.Request, update func(context.Context, int64, int64) (store.LikeState, error)) {
+	user := getAuthUserFromContext(r)
+	post := getPostFromContext(r)
+
+	state, err := update(r.Context(), post.ID, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, state); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
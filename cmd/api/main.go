@@ -1,12 +1,17 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"github.com/caturandi-labs/go-social/internal/auth"
+	"github.com/caturandi-labs/go-social/internal/blob"
 	db "github.com/caturandi-labs/go-social/internal/db"
 	"github.com/caturandi-labs/go-social/internal/env"
+	"github.com/caturandi-labs/go-social/internal/mailer"
 	"github.com/caturandi-labs/go-social/internal/store"
 	"log"
+	"time"
 )
 
 const version = "0.0.1"
@@ -21,6 +26,62 @@ func main() {
 			maxIdleTime:  env.GetString("DB_MAX_IDLE_TIME", "15m"),
 		},
 		env: env.GetString("API_ENV", "development"),
+		auth: authConfig{
+			token: tokenConfig{
+				secret: env.GetString("AUTH_TOKEN_SECRET", "example"),
+				exp:    time.Hour * 24 * 3,
+				iss:    "gosocial",
+			},
+		},
+		mail: mailConfig{
+			exp:       time.Hour * 24 * 3,
+			backend:   env.GetString("MAILER_BACKEND", "log"),
+			fromEmail: env.GetString("FROM_EMAIL", "GoSocial <no-reply@gosocial.local>"),
+			dir:       env.GetString("MAILER_DIR", "./tmp/mail"),
+			smtp: smtpConfig{
+				host:     env.GetString("SMTP_HOST", "localhost"),
+				port:     env.GetInt("SMTP_PORT", 1025),
+				username: env.GetString("SMTP_USERNAME", ""),
+				password: env.GetString("SMTP_PASSWORD", ""),
+			},
+		},
+		blob: blobConfig{
+			backend: env.GetString("BLOB_BACKEND", "local"),
+			dir:     env.GetString("BLOB_DIR", "./tmp/blobs"),
+			baseURL: env.GetString("BLOB_BASE_URL", "http://localhost:8080/v1/files"),
+			s3: s3Config{
+				endpoint:  env.GetString("S3_ENDPOINT", "localhost:9000"),
+				region:    env.GetString("S3_REGION", "us-east-1"),
+				bucket:    env.GetString("S3_BUCKET", "go-social"),
+				accessKey: env.GetString("S3_ACCESS_KEY", ""),
+				secretKey: env.GetString("S3_SECRET_KEY", ""),
+				useSSL:    env.GetBool("S3_USE_SSL", false),
+				publicURL: env.GetString("S3_PUBLIC_URL", ""),
+			},
+		},
+		posts: postsConfig{
+			restoreWindow:   env.GetDuration("POSTS_RESTORE_WINDOW", time.Hour*24*7),
+			retention:       env.GetDuration("POSTS_RETENTION", time.Hour*24*30),
+			purgeInterval:   env.GetDuration("POSTS_PURGE_INTERVAL", time.Hour),
+			publishInterval: env.GetDuration("POSTS_PUBLISH_INTERVAL", time.Second*30),
+		},
+		frontendURL: env.GetString("FRONTEND_URL", "http://localhost:5173"),
+	}
+
+	// the default and example secrets are public, anyone could sign tokens with them
+	switch cfg.auth.token.secret {
+	case "", "example", "change-me":
+		if cfg.env != "development" {
+			log.Panicf("AUTH_TOKEN_SECRET must be set when API_ENV is %q", cfg.env)
+		}
+	}
+
+	// tickers panic on non-positive intervals, refuse to start instead
+	if cfg.posts.purgeInterval <= 0 {
+		log.Panicf("POSTS_PURGE_INTERVAL must be positive, got %s", cfg.posts.purgeInterval)
+	}
+	if cfg.posts.publishInterval <= 0 {
+		log.Panicf("POSTS_PUBLISH_INTERVAL must be positive, got %s", cfg.posts.publishInterval)
 	}
 
 	dbConn, err := db.New(
@@ -45,11 +106,61 @@ func main() {
 
 	pgStore := store.NewPostgresStorage(dbConn)
 
+	jwtAuthenticator := auth.NewJWTAuthenticator(
+		cfg.auth.token.secret,
+		cfg.auth.token.iss,
+		cfg.auth.token.iss,
+	)
+
+	mailClient, err := newMailer(cfg.mail)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	blobStore, err := newBlobStore(cfg.blob)
+	if err != nil {
+		log.Panic(err)
+	}
+
 	app := &application{
-		config: cfg,
-		store:  pgStore,
+		config:        cfg,
+		store:         pgStore,
+		authenticator: jwtAuthenticator,
+		mailer:        mailClient,
+		blob:          blobStore,
+		mediaQueue:    make(chan struct{}, 1),
 	}
 
+	go app.runMediaWorker(context.Background())
+	go app.runPostPurger(context.Background())
+	go app.runPostScheduler(context.Background())
+
 	mux := app.mount()
 	log.Fatal(app.run(mux))
 }
+
+func newMailer(cfg mailConfig) (mailer.Client, error) {
+	switch cfg.backend {
+	case "smtp":
+		return mailer.NewSMTPClient(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.fromEmail), nil
+	case "file":
+		return mailer.NewFileClient(cfg.dir, cfg.fromEmail)
+	case "log":
+		return mailer.NewLogClient(cfg.fromEmail), nil
+	default:
+		return nil, fmt.Errorf("unknown mailer backend %q", cfg.backend)
+	}
+}
+
+func newBlobStore(cfg blobConfig) (blob.Store, error) {
+	switch cfg.backend {
+	case "local":
+		return blob.NewLocalStore(cfg.dir, cfg.baseURL)
+	case "s3":
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return blob.NewS3Store(ctx, cfg.s3.endpoint, cfg.s3.region, cfg.s3.bucket, cfg.s3.accessKey, cfg.s3.secretKey, cfg.s3.useSSL, cfg.s3.publicURL, mediaKeyPrefix)
+	default:
+		return nil, fmt.Errorf("unknown blob backend %q", cfg.backend)
+	}
+}
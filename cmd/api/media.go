@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"github.com/caturandi-labs/go-social/internal/store"
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/go-chi/chi/v5"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const maxUploadSize = 10 << 20 // 10 MB
+
+const (
+	// uploadKeyPrefix holds raw uploads until the media worker has processed
+	// them. They still carry their metadata and are never served.
+	uploadKeyPrefix = "uploads/"
+	// mediaKeyPrefix holds the processed media, which are public.
+	mediaKeyPrefix = "media/"
+)
+
+// allowedMediaTypes maps the sniffed MIME types accepted for uploads to the
+// extension used in the storage key.
+var allowedMediaTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+func (app *application) uploadMediaHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromContext(r)
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize+1024*1024)
+	if err := r.ParseMultipartForm(maxUploadSize); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	defer func() { _ = r.MultipartForm.RemoveAll() }()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	defer file.Close()
+
+	if header.Size > maxUploadSize {
+		app.unprocessableEntityResponse(w, r, map[string]string{"file": fmt.Sprintf("file must be smaller than %d bytes", maxUploadSize)})
+		return
+	}
+
+	// sniff the content instead of trusting the client supplied Content-Type
+	head := make([]byte, 3072)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	head = head[:n]
+
+	contentType := mimetype.Detect(head).String()
+	ext, ok := allowedMediaTypes[contentType]
+	if !ok {
+		app.unprocessableEntityResponse(w, r, map[string]string{"file": fmt.Sprintf("unsupported media type %s", contentType)})
+		return
+	}
+
+	// the upload keeps its metadata until the worker has stripped it, so it
+	// lives under a separate prefix and is never handed out to clients
+	media := &store.Media{
+		UserID:      user.ID,
+		Key:         fmt.Sprintf("%s%d/%s%s", uploadKeyPrefix, user.ID, rand.Text(), ext),
+		ContentType: contentType,
+		Size:        header.Size,
+	}
+
+	ctx := r.Context()
+	content := io.MultiReader(bytes.NewReader(head), file)
+	if err := app.blob.Put(ctx, media.Key, content, media.Size, media.ContentType); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.Media.Create(ctx, media); err != nil {
+		_ = app.blob.Delete(ctx, media.Key)
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.notifyMediaWorker()
+
+	w.Header().Set("Location", fmt.Sprintf("/v1/media/%d", media.ID))
+	if err := app.jsonResponse(w, http.StatusAccepted, media); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getMediaHandler lets the uploader poll the processing status of a media
+// item. Other users get a 404 so IDs can't be probed.
+func (app *application) getMediaHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromContext(r)
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	media, err := app.store.Media.GetByID(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if media.UserID != user.ID {
+		app.notFoundResponse(w, r, store.ErrNotFound)
+		return
+	}
+	app.setMediaURLs(media)
+
+	if err := app.jsonResponse(w, http.StatusOK, media); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// setMediaURLs fills in the download URLs once the media has been processed.
+func (app *application) setMediaURLs(media *store.Media) {
+	if !media.IsReady() {
+		return
+	}
+
+	media.URL = app.blob.URL(media.Key)
+	if media.ThumbnailKey != "" {
+		media.ThumbnailURL = app.blob.URL(media.ThumbnailKey)
+	}
+}
+
+// publicFiles serves the blob store below /v1/files, leaving out the raw
+// uploads.
+func publicFiles(files http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(path.Clean("/"+r.URL.Path)+"/", "/"+uploadKeyPrefix) {
+			http.NotFound(w, r)
+			return
+		}
+		files.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"github.com/caturandi-labs/go-social/internal/imaging"
+	"github.com/caturandi-labs/go-social/internal/store"
+	"io"
+	"log"
+	"time"
+)
+
+const (
+	mediaPollInterval = 30 * time.Second
+	mediaBatchSize    = 5
+	thumbnailSize     = 320
+)
+
+// notifyMediaWorker wakes the worker without blocking; a pending wake-up
+// already covers any number of new uploads.
+func (app *application) notifyMediaWorker() {
+	select {
+	case app.mediaQueue <- struct{}{}:
+	default:
+	}
+}
+
+// runMediaWorker processes uploaded media in the background until ctx is
+// cancelled. Besides reacting to new uploads it polls periodically, picking up
+// items left over by restarts or other instances.
+func (app *application) runMediaWorker(ctx context.Context) {
+	ticker := time.NewTicker(mediaPollInterval)
+	defer ticker.Stop()
+
+	for {
+		app.processPendingMedia(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-app.mediaQueue:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (app *application) processPendingMedia(ctx context.Context) {
+	for ctx.Err() == nil {
+		batch, err := app.store.Media.ClaimPending(ctx, mediaBatchSize)
+		if err != nil {
+			log.Printf("media worker: claiming pending media: %v", err)
+			return
+		}
+		if len(batch) == 0 {
+			return
+		}
+
+		for i := range batch {
+			media := &batch[i]
+			if err := app.processMedia(ctx, media); err != nil {
+				log.Printf("media worker: processing media %d: %v", media.ID, err)
+
+				// broken images won't get any better, anything else is retried
+				retry := !errors.Is(err, imaging.ErrInvalidImage)
+				if err := app.store.Media.MarkFailed(ctx, media, err.Error(), retry); err != nil {
+					log.Printf("media worker: marking media %d as failed: %v", media.ID, err)
+				}
+			}
+		}
+	}
+}
+
+// processMedia strips the metadata from the upload, stores it next to a
+// thumbnail under fresh keys and removes the original once the record points
+// at the processed copies.
+func (app *application) processMedia(ctx context.Context, media *store.Media) error {
+	rc, err := app.blob.Get(ctx, media.Key)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(io.LimitReader(rc, maxUploadSize+1))
+	_ = rc.Close()
+	if err != nil {
+		return err
+	}
+
+	res, err := processImage(data, media.ContentType)
+	if err != nil {
+		return err
+	}
+
+	base := fmt.Sprintf("%s%d/%s", mediaKeyPrefix, media.UserID, rand.Text())
+	key := base + allowedMediaTypes[media.ContentType]
+	thumbnailKey := base + "_thumb" + allowedMediaTypes[res.ThumbnailContentType]
+
+	if err := app.blob.Put(ctx, key, bytes.NewReader(res.Image), int64(len(res.Image)), media.ContentType); err != nil {
+		return err
+	}
+	if err := app.blob.Put(ctx, thumbnailKey, bytes.NewReader(res.Thumbnail), int64(len(res.Thumbnail)), res.ThumbnailContentType); err != nil {
+		_ = app.blob.Delete(ctx, key)
+		return err
+	}
+
+	uploadKey := media.Key
+	media.Key = key
+	media.ThumbnailKey = thumbnailKey
+	media.Size = int64(len(res.Image))
+	media.Width = res.Width
+	media.Height = res.Height
+	media.Blurhash = res.Blurhash
+
+	if err := app.store.Media.MarkReady(ctx, media); err != nil {
+		_ = app.blob.Delete(ctx, key)
+		_ = app.blob.Delete(ctx, thumbnailKey)
+		if errors.Is(err, store.ErrNotFound) {
+			// the claim timed out meanwhile and the item was reclaimed or
+			// failed, whoever holds it now owns the outcome
+			return nil
+		}
+		return err
+	}
+
+	if err := app.blob.Delete(ctx, uploadKey); err != nil {
+		log.Printf("media worker: deleting upload %s: %v", uploadKey, err)
+	}
+
+	return nil
+}
+
+// processImage runs imaging.Process, turning a panic on a malformed image into
+// ErrInvalidImage so a single upload can't take down the worker.
+func processImage(data []byte, contentType string) (res *imaging.Result, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", imaging.ErrInvalidImage, r)
+		}
+	}()
+
+	return imaging.Process(data, contentType, thumbnailSize)
+}
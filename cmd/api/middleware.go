@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/caturandi-labs/go-social/internal/store"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const authUserCtxKey userKey = "authUser"
+
+func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// already authenticated by OptionalAuthTokenMiddleware
+		if getAuthUserFromContext(r) != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			app.unauthorizedResponse(w, r, errors.New("authorization header is missing"))
+			return
+		}
+
+		app.authenticate(w, r, authHeader, next)
+	})
+}
+
+// OptionalAuthTokenMiddleware authenticates the request when it carries a
+// bearer token and lets anonymous requests through untouched. Invalid tokens
+// are still rejected.
+func (app *application) OptionalAuthTokenMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		app.authenticate(w, r, authHeader, next)
+	})
+}
+
+func (app *application) authenticate(w http.ResponseWriter, r *http.Request, authHeader string, next http.Handler) {
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		app.unauthorizedResponse(w, r, errors.New("authorization header is malformed"))
+		return
+	}
+
+	jwtToken, err := app.authenticator.ValidateToken(parts[1])
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+
+	sub, err := jwtToken.Claims.GetSubject()
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+
+	userID, err := strconv.ParseInt(sub, 10, 64)
+	if err != nil {
+		app.unauthorizedResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user, err := app.store.Users.GetByID(ctx, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.unauthorizedResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if !user.IsActive {
+		app.unauthorizedResponse(w, r, errors.New("user is not activated"))
+		return
+	}
+
+	ctx = context.WithValue(ctx, authUserCtxKey, user)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// viewerID returns the ID of the authenticated user, or 0 for anonymous
+// requests.
+func viewerID(r *http.Request) int64 {
+	if user := getAuthUserFromContext(r); user != nil {
+		return user.ID
+	}
+	return 0
+}
+
+// checkPostOwnership lets the author of the post through, as well as any user
+// whose role is at least as privileged as requiredRole.
+func (app *application) checkPostOwnership(requiredRole string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := getAuthUserFromContext(r)
+		post := getPostFromContext(r)
+
+		if post.UserID == user.ID {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		allowed, err := app.checkRolePrecedence(r.Context(), user, requiredRole)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if !allowed {
+			app.forbiddenResponse(w, r, fmt.Errorf("user %d lacks role %q for post %d", user.ID, requiredRole, post.ID))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// checkCommentOwnership works like checkPostOwnership for comments. An empty
+// requiredRole restricts access to the author of the comment.
+func (app *application) checkCommentOwnership(requiredRole string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := getAuthUserFromContext(r)
+		comment := getCommentFromContext(r)
+
+		if comment.UserID == user.ID {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if requiredRole == "" {
+			app.forbiddenResponse(w, r, fmt.Errorf("user %d is not the author of comment %d", user.ID, comment.ID))
+			return
+		}
+
+		allowed, err := app.checkRolePrecedence(r.Context(), user, requiredRole)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if !allowed {
+			app.forbiddenResponse(w, r, fmt.Errorf("user %d lacks role %q for comment %d", user.ID, requiredRole, comment.ID))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+func (app *application) checkRolePrecedence(ctx context.Context, user *store.User, roleName string) (bool, error) {
+	role, err := app.store.Roles.GetByName(ctx, roleName)
+	if err != nil {
+		return false, err
+	}
+
+	return user.Role.Level >= role.Level, nil
+}
+
+func getAuthUserFromContext(r *http.Request) *store.User {
+	user, _ := r.Context().Value(authUserCtxKey).(*store.User)
+	return user
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+const postPurgeBatchSize = 500
+
+// runPostPurger hard deletes posts once they have been soft deleted for longer
+// than the retention period, until ctx is cancelled.
+func (app *application) runPostPurger(ctx context.Context) {
+	ticker := time.NewTicker(app.config.posts.purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		app.purgeDeletedPosts(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeDeletedPosts works in batches so a large backlog doesn't hold locks on
+// the posts table for long.
+func (app *application) purgeDeletedPosts(ctx context.Context) {
+	var total int64
+	for ctx.Err() == nil {
+		n, err := app.store.Posts.PurgeDeleted(ctx, app.config.posts.retention, postPurgeBatchSize)
+		if err != nil {
+			log.Printf("post purger: %v", err)
+			break
+		}
+		total += n
+		if n < postPurgeBatchSize {
+			break
+		}
+	}
+
+	if total > 0 {
+		log.Printf("post purger: removed %d deleted posts", total)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+const postPublishBatchSize = 100
+
+// runPostScheduler publishes scheduled posts once their publish time has
+// passed, until ctx is cancelled. The schedule lives in the database, so
+// posts due while the API was down are published on the first run.
+func (app *application) runPostScheduler(ctx context.Context) {
+	ticker := time.NewTicker(app.config.posts.publishInterval)
+	defer ticker.Stop()
+
+	for {
+		app.publishDuePosts(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (app *application) publishDuePosts(ctx context.Context) {
+	for ctx.Err() == nil {
+		n, err := app.store.Posts.PublishDue(ctx, postPublishBatchSize)
+		if err != nil {
+			log.Printf("post scheduler: %v", err)
+			return
+		}
+		if n > 0 {
+			log.Printf("post scheduler: published %d posts", n)
+		}
+		if n < postPublishBatchSize {
+			return
+		}
+	}
+}
@@ -8,12 +8,20 @@ import (
 	"github.com/go-chi/chi/v5"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type CreatePostPayload struct {
-	Title   string   `json:"title" validate:"required"`
-	Content string   `json:"content" validate:"required"`
-	Tags    []string `json:"tags"`
+	Title    string   `json:"title" validate:"required,max=100"`
+	Content  string   `json:"content" validate:"required,max=10000"`
+	Tags     []string `json:"tags"`
+	MediaIDs []int64  `json:"media_ids" validate:"max=4"`
+	// QuotedPostID turns the post into a quote of another post.
+	QuotedPostID *int64 `json:"quoted_post_id"`
+	// Status defaults to published; scheduled posts need a PublishAt.
+	Status    *string    `json:"status" validate:"omitnil,oneof=draft scheduled published"`
+	PublishAt *time.Time `json:"publish_at"`
 }
 
 func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request) {
@@ -29,14 +37,50 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	status, publishAt, validationErr := resolvePublishing("", nil, post.Status, post.PublishAt)
+	if validationErr != nil {
+		app.unprocessableEntityResponse(w, r, validationErr)
+		return
+	}
+
+	user := getAuthUserFromContext(r)
+
 	newPost := &store.Post{
-		Title:   post.Title,
-		Content: post.Content,
-		UserID:  1,
-		Tags:    post.Tags,
+		Title:     post.Title,
+		Content:   post.Content,
+		UserID:    user.ID,
+		Tags:      post.Tags,
+		MediaIDs:  post.MediaIDs,
+		Status:    status,
+		PublishAt: publishAt,
 	}
 	ctx := r.Context()
+
+	if post.QuotedPostID != nil {
+		quoted, err := app.quotablePost(ctx, *post.QuotedPostID, user.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.unprocessableEntityResponse(w, r, map[string]string{"quoted_post_id": "Unknown post"})
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+		newPost.QuotedPostID = &quoted.ID
+		newPost.QuotedPost = quoted
+	}
 	if err := app.store.Posts.Create(ctx, newPost); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.unprocessableEntityResponse(w, r, map[string]string{"media_ids": "Unknown, failed or already attached media"})
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.loadPostMedia(r, newPost); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
@@ -48,40 +92,52 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 }
 
 func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
-	paramId := chi.URLParam(r, "id")
-	fmt.Println(paramId)
-	id, err := strconv.ParseInt(paramId, 10, 64)
-	ctx := r.Context()
-	post, err := app.store.Posts.GetByID(ctx, id)
+	post := getPostFromContext(r)
+
+	comments, err := app.store.Comments.GetByPostID(r.Context(), post.ID, viewerID(r))
 	if err != nil {
-		switch {
-		case errors.Is(err, store.ErrNotFound):
-			app.notFoundResponse(w, r, err)
-		default:
-			app.internalServerError(w, r, err)
-		}
+		app.internalServerError(w, r, err)
 		return
 	}
+	post.Comments = comments
 
-	comments, err := app.store.Comments.GetByPostID(ctx, id)
-	if err != nil {
+	if err := app.loadPostMedia(r, post); err != nil {
 		app.internalServerError(w, r, err)
+		return
 	}
-	post.Comments = comments
 
+	setPostETag(w, post)
 	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
 		app.internalServerError(w, r, err)
 	}
 }
 
 type UpdatePostPayload struct {
-	Title   *string `json:"title" validate:"required,min=3"`
-	Content *string `json:"content" validate:"required,min=3"`
+	Title     *string    `json:"title" validate:"required,min=3,max=100"`
+	Content   *string    `json:"content" validate:"required,min=3,max=10000"`
+	Status    *string    `json:"status" validate:"omitnil,oneof=draft scheduled published"`
+	PublishAt *time.Time `json:"publish_at"`
 }
 
 func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request) {
 	post := getPostFromContext(r)
 
+	if post.RepostOfID != nil {
+		app.badRequestResponse(w, r, errors.New("reposts cannot be edited"))
+		return
+	}
+
+	expectedVersion, hasPrecondition, err := parseIfMatch(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if hasPrecondition && expectedVersion != post.Version {
+		app.preconditionFailedResponse(w, r, fmt.Errorf("post %d is at version %d, client expected %d", post.ID, post.Version, expectedVersion))
+		return
+	}
+
 	var payload UpdatePostPayload
 	if err := readJSON(w, r, &payload); err != nil {
 		app.badRequestResponse(w, r, err)
@@ -94,6 +150,14 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	status, publishAt, validationErr := resolvePublishing(post.Status, post.PublishAt, payload.Status, payload.PublishAt)
+	if validationErr != nil {
+		app.unprocessableEntityResponse(w, r, validationErr)
+		return
+	}
+	post.Status = status
+	post.PublishAt = publishAt
+
 	if payload.Title != nil {
 		post.Title = *payload.Title
 	}
@@ -102,10 +166,18 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	if err := app.store.Posts.Update(r.Context(), post); err != nil {
-		app.internalServerError(w, r, err)
+		switch {
+		case errors.Is(err, store.ErrEditConflict) && hasPrecondition:
+			app.preconditionFailedResponse(w, r, err)
+		case errors.Is(err, store.ErrEditConflict):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
 		return
 	}
 
+	setPostETag(w, post)
 	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -113,33 +185,54 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 }
 
 func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromContext(r)
 
-	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
-	if err != nil {
-		app.internalServerError(w, r, err)
+	if err := app.store.Posts.Delete(r.Context(), post.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
 	}
-	
-	ctx := r.Context()
 
-	if err := app.store.Posts.Delete(ctx, id); err != nil {
+	_ = app.jsonResponse(w, http.StatusNoContent, nil)
+}
+
+// restorePostHandler undoes the deletion of a post within the restore window.
+func (app *application) restorePostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromContext(r)
+
+	if err := app.store.Posts.Restore(r.Context(), post.ID, app.config.posts.restoreWindow); err != nil {
 		switch {
 		case errors.Is(err, store.ErrNotFound):
 			app.notFoundResponse(w, r, err)
+		case errors.Is(err, store.ErrConflict):
+			app.conflictResponse(w, r, err)
 		default:
 			app.internalServerError(w, r, err)
 		}
 		return
 	}
+	post.DeletedAt = nil
 
-	_ = app.jsonResponse(w, http.StatusNoContent, nil)
+	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
+		app.internalServerError(w, r, err)
+	}
 }
 
 func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		paramId := chi.URLParam(r, "id")
 		id, err := strconv.ParseInt(paramId, 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
 		ctx := r.Context()
-		post, err := app.store.Posts.GetByID(ctx, id)
+		post, err := app.store.Posts.GetByID(ctx, id, viewerID(r))
 		if err != nil {
 			switch {
 			case errors.Is(err, store.ErrNotFound):
@@ -154,7 +247,117 @@ func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// resolvePublishing works out the status and publish time of a post from its
+// current ones and those requested by the client. An empty current status
+// stands for a post being created. Invalid combinations are returned as
+// validation errors. Only a publish time sent by the client has to lie in the
+// future; a kept one may already have passed while the post waits for the
+// scheduler.
+func resolvePublishing(current string, currentPublishAt *time.Time, status *string, publishAt *time.Time) (string, *time.Time, map[string]string) {
+	if current == store.PostStatusPublished {
+		switch {
+		case status != nil && *status != store.PostStatusPublished:
+			return "", nil, map[string]string{"status": "Published posts cannot be unpublished"}
+		case publishAt != nil:
+			return "", nil, map[string]string{"publish_at": "Published posts cannot be rescheduled"}
+		}
+		return current, nil, nil
+	}
+
+	next := current
+	if next == "" {
+		next = store.PostStatusPublished
+	}
+	if status != nil {
+		next = *status
+	}
+
+	if next != store.PostStatusScheduled {
+		if publishAt != nil {
+			return "", nil, map[string]string{"publish_at": "Only scheduled posts take a publish time"}
+		}
+		return next, nil, nil
+	}
+
+	switch {
+	case publishAt == nil && currentPublishAt == nil:
+		return "", nil, map[string]string{"publish_at": "Scheduled posts need a publish time"}
+	case publishAt == nil:
+		return next, currentPublishAt, nil
+	case !publishAt.After(time.Now()):
+		return "", nil, map[string]string{"publish_at": "Publish time must be in the future"}
+	}
+	return next, publishAt, nil
+}
+
+// deletedPostContextMiddleware loads a post that is still within its restore
+// window, for the routes dealing with deleted posts.
+func (app *application) deletedPostContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+		post, err := app.store.Posts.GetDeletedByID(ctx, id, app.config.posts.restoreWindow)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		ctx = context.WithValue(ctx, "post", post)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 func getPostFromContext(r *http.Request) *store.Post {
 	post, _ := r.Context().Value("post").(*store.Post)
 	return post
 }
+
+func setPostETag(w http.ResponseWriter, post *store.Post) {
+	w.Header().Set("ETag", strconv.Quote(strconv.FormatInt(post.Version, 10)))
+}
+
+// parseIfMatch reads the post version a client expects from the If-Match
+// header. Both ETags as returned by setPostETag and bare version numbers are
+// accepted.
+func parseIfMatch(r *http.Request) (int64, bool, error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		return 0, false, nil
+	}
+
+	tag := strings.TrimPrefix(header, "W/")
+	if unquoted, err := strconv.Unquote(tag); err == nil {
+		tag = unquoted
+	}
+
+	version, err := strconv.ParseInt(tag, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid If-Match header %q", header)
+	}
+
+	return version, true, nil
+}
+
+func (app *application) loadPostMedia(r *http.Request, post *store.Post) error {
+	media, err := app.store.Media.GetByPostID(r.Context(), post.ID)
+	if err != nil {
+		return err
+	}
+
+	for i := range media {
+		app.setMediaURLs(&media[i])
+	}
+	post.Media = media
+
+	return nil
+}
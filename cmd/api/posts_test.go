@@ -0,0 +1,139 @@
+package main
+
+import (
+	"github.com/caturandi-labs/go-social/internal/store"
+	"testing"
+	"time"
+)
+
+func TestResolvePublishing(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+	later := time.Now().Add(2 * time.Hour)
+	past := time.Now().Add(-time.Hour)
+	status := func(s string) *string { return &s }
+
+	tests := []struct {
+		name             string
+		current          string
+		currentPublishAt *time.Time
+		status           *string
+		publishAt        *time.Time
+		wantStatus       string
+		wantPublishAt    *time.Time
+		wantErr          string
+	}{
+		{
+			name:       "new post defaults to published",
+			wantStatus: store.PostStatusPublished,
+		},
+		{
+			name:       "new draft",
+			status:     status(store.PostStatusDraft),
+			wantStatus: store.PostStatusDraft,
+		},
+		{
+			name:          "new scheduled post",
+			status:        status(store.PostStatusScheduled),
+			publishAt:     &future,
+			wantStatus:    store.PostStatusScheduled,
+			wantPublishAt: &future,
+		},
+		{
+			name:    "scheduled without a publish time",
+			status:  status(store.PostStatusScheduled),
+			wantErr: "publish_at",
+		},
+		{
+			name:      "scheduled in the past",
+			status:    status(store.PostStatusScheduled),
+			publishAt: &past,
+			wantErr:   "publish_at",
+		},
+		{
+			name:      "publish time on a draft",
+			status:    status(store.PostStatusDraft),
+			publishAt: &future,
+			wantErr:   "publish_at",
+		},
+		{
+			name:       "published stays published",
+			current:    store.PostStatusPublished,
+			wantStatus: store.PostStatusPublished,
+		},
+		{
+			name:    "published cannot be unpublished",
+			current: store.PostStatusPublished,
+			status:  status(store.PostStatusDraft),
+			wantErr: "status",
+		},
+		{
+			name:      "published cannot be rescheduled",
+			current:   store.PostStatusPublished,
+			publishAt: &future,
+			wantErr:   "publish_at",
+		},
+		{
+			name:       "draft published",
+			current:    store.PostStatusDraft,
+			status:     status(store.PostStatusPublished),
+			wantStatus: store.PostStatusPublished,
+		},
+		{
+			name:             "scheduled post keeps its publish time",
+			current:          store.PostStatusScheduled,
+			currentPublishAt: &future,
+			wantStatus:       store.PostStatusScheduled,
+			wantPublishAt:    &future,
+		},
+		{
+			name:             "kept publish time may have passed",
+			current:          store.PostStatusScheduled,
+			currentPublishAt: &past,
+			wantStatus:       store.PostStatusScheduled,
+			wantPublishAt:    &past,
+		},
+		{
+			name:             "scheduled post rescheduled",
+			current:          store.PostStatusScheduled,
+			currentPublishAt: &future,
+			publishAt:        &later,
+			wantStatus:       store.PostStatusScheduled,
+			wantPublishAt:    &later,
+		},
+		{
+			name:             "scheduled post rescheduled into the past",
+			current:          store.PostStatusScheduled,
+			currentPublishAt: &future,
+			publishAt:        &past,
+			wantErr:          "publish_at",
+		},
+		{
+			name:             "scheduled post turned into a draft",
+			current:          store.PostStatusScheduled,
+			currentPublishAt: &future,
+			status:           status(store.PostStatusDraft),
+			wantStatus:       store.PostStatusDraft,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStatus, gotPublishAt, errs := resolvePublishing(tt.current, tt.currentPublishAt, tt.status, tt.publishAt)
+			if tt.wantErr != "" {
+				if _, ok := errs[tt.wantErr]; !ok {
+					t.Fatalf("got errors %v, want one for %s", errs, tt.wantErr)
+				}
+				return
+			}
+			if errs != nil {
+				t.Fatalf("unexpected errors: %v", errs)
+			}
+			if gotStatus != tt.wantStatus {
+				t.Errorf("status = %q, want %q", gotStatus, tt.wantStatus)
+			}
+			if gotPublishAt != tt.wantPublishAt {
+				t.Errorf("publish_at = %v, want %v", gotPublishAt, tt.wantPublishAt)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/caturandi-labs/go-social/internal/store"
+	"net/http"
+)
+
+// repostHandler shares the post in the URL with the followers of the
+// authenticated user and responds with the new repost.
+func (app *application) repostHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromContext(r)
+	post := getPostFromContext(r)
+	ctx := r.Context()
+
+	repost, err := app.store.Posts.Repost(ctx, user.ID, post.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		case errors.Is(err, store.ErrConflict):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	repost, err = app.store.Posts.GetByID(ctx, repost.ID, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, repost); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) unrepostHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromContext(r)
+	post := getPostFromContext(r)
+
+	if err := app.store.Posts.Unrepost(r.Context(), user.ID, post.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	_ = app.jsonResponse(w, http.StatusNoContent, nil)
+}
+
+// quotablePost returns the preview of the post a new post quotes. Quoting a
+// repost quotes the original, and unpublished posts or posts the viewer can't
+// see are reported as store.ErrNotFound.
+func (app *application) quotablePost(ctx context.Context, postID int64, viewerID int64) (*store.PostPreview, error) {
+	post, err := app.store.Posts.GetByID(ctx, postID, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	if post.Status != store.PostStatusPublished {
+		return nil, store.ErrNotFound
+	}
+
+	if post.RepostOf == nil {
+		return post.Preview(), nil
+	}
+	if post.RepostOf.Unavailable {
+		return nil, store.ErrNotFound
+	}
+	return post.RepostOf, nil
+}
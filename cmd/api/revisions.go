@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/caturandi-labs/go-social/internal/diff"
+	"github.com/caturandi-labs/go-social/internal/store"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strconv"
+)
+
+func (app *application) getPostRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromContext(r)
+
+	revisions, err := app.store.Posts.GetRevisions(r.Context(), post.ID, viewerID(r))
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, revisions); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) getPostRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromContext(r)
+
+	version, err := strconv.ParseInt(chi.URLParam(r, "version"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	revision, err := app.store.Posts.GetRevision(r.Context(), post.ID, version, viewerID(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, revision); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+type PostRevisionDiff struct {
+	From    int64       `json:"from"`
+	To      int64       `json:"to"`
+	Title   []diff.Line `json:"title"`
+	Content []diff.Line `json:"content"`
+}
+
+// getPostRevisionDiffHandler compares two versions of the post line by line.
+// The from and to query parameters default to the previous version the viewer
+// may see and the current one.
+func (app *application) getPostRevisionDiffHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromContext(r)
+	ctx := r.Context()
+	viewer := viewerID(r)
+
+	var revisions [2]*store.PostRevision
+	for i, param := range []string{"from", "to"} {
+		version := post.Version
+		if param == "from" && r.URL.Query().Get(param) == "" {
+			previous, err := app.previousRevision(ctx, post, viewer)
+			if err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
+			version = previous
+		}
+
+		if value := r.URL.Query().Get(param); value != "" {
+			v, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				app.badRequestResponse(w, r, fmt.Errorf("invalid %s %q", param, value))
+				return
+			}
+			version = v
+		}
+
+		revision, err := app.store.Posts.GetRevision(ctx, post.ID, version, viewer)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, fmt.Errorf("post %d has no version %d", post.ID, version))
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+		revisions[i] = revision
+	}
+
+	from, to := revisions[0], revisions[1]
+	result := PostRevisionDiff{
+		From:    from.Version,
+		To:      to.Version,
+		Title:   diff.Lines(from.Title, to.Title),
+		Content: diff.Lines(from.Content, to.Content),
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, result); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// previousRevision returns the version before the current one that viewer may
+// see, or the current one when there is none.
+func (app *application) previousRevision(ctx context.Context, post *store.Post, viewer int64) (int64, error) {
+	revisions, err := app.store.Posts.GetRevisions(ctx, post.ID, viewer)
+	if err != nil {
+		return 0, err
+	}
+	if len(revisions) < 2 {
+		return post.Version, nil
+	}
+	return revisions[1].Version, nil
+}
@@ -3,10 +3,12 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/caturandi-labs/go-social/internal/store"
 	"github.com/go-chi/chi/v5"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 type userKey string
@@ -14,88 +16,327 @@ type userKey string
 const userCtxKey userKey = "user"
 
 func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
-	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
-	if err != nil {
-		app.badRequestResponse(w, r, err)
+	user := getUserFromContext(r)
+
+	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+		app.internalServerError(w, r, err)
 		return
 	}
 
-	ctx := r.Context()
+}
 
-	user, err := app.store.Users.GetByID(ctx, userID)
+func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+
+	err := app.store.Users.Activate(r.Context(), token)
 	if err != nil {
 		switch {
 		case errors.Is(err, store.ErrNotFound):
 			app.notFoundResponse(w, r, err)
-			return
 		default:
 			app.internalServerError(w, r, err)
-			return
 		}
+		return
 	}
 
-	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
-		app.internalServerError(w, r, err)
+	_ = app.jsonResponse(w, http.StatusNoContent, nil)
+}
+
+func (app *application) getUserFollowersHandler(w http.ResponseWriter, r *http.Request) {
+	app.listFollows(w, r, app.store.Followers.GetFollowers)
+}
+
+func (app *application) getUserFollowingHandler(w http.ResponseWriter, r *http.Request) {
+	app.listFollows(w, r, app.store.Followers.GetFollowing)
+}
+
+func (app *application) listFollows(w http.ResponseWriter, r *http.Request, list func(context.Context, int64, int64, store.PaginatedQuery) ([]store.FollowUser, store.Pagination, error)) {
+	user := getUserFromContext(r)
+
+	q := store.PaginatedQuery{
+		Limit: 20,
+		Sort:  "desc",
+	}
+
+	q, err := q.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
 		return
 	}
 
-}
+	if err := Validate.Struct(q); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	users, pagination, err := list(r.Context(), user.ID, viewerID(r), q)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
 
-type FollowUser struct {
-	UserID int64 `json:"user_id"`
+	if err := app.paginatedJSONResponse(w, http.StatusOK, users, pagination); err != nil {
+		app.internalServerError(w, r, err)
+	}
 }
 
 func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request) {
-	followerUser := getUserFromContext(r)
-	var payload FollowUser
+	followerUser := getAuthUserFromContext(r)
+	followedUser := getUserFromContext(r)
 
-	if err := readJSON(w, r, &payload); err != nil {
-		app.badRequestResponse(w, r, err)
+	ctx := r.Context()
+	state, err := app.store.Followers.Follow(ctx, followerUser.ID, followedUser.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrSelfFollow):
+			app.badRequestResponse(w, r, err)
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		case errors.Is(err, store.ErrConflict):
+			app.conflictResponse(w, r, err)
+		case errors.Is(err, store.ErrBlocked):
+			app.forbiddenResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
 		return
 	}
 
+	if state == store.FollowStateRequested {
+		if err := app.jsonResponse(w, http.StatusAccepted, map[string]store.FollowState{"status": state}); err != nil {
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	_ = app.jsonResponse(w, http.StatusNoContent, nil)
+}
+
+func (app *application) unFollowUserHandler(w http.ResponseWriter, r *http.Request) {
+	followerUser := getAuthUserFromContext(r)
+	unfollowedUser := getUserFromContext(r)
+
 	ctx := r.Context()
-	err := app.store.Followers.Follow(ctx, followerUser.ID, payload.UserID)
+	err := app.store.Followers.Unfollow(ctx, followerUser.ID, unfollowedUser.ID)
 	if err != nil {
 		switch {
+		case errors.Is(err, store.ErrSelfFollow):
+			app.badRequestResponse(w, r, err)
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	_ = app.jsonResponse(w, http.StatusNoContent, nil)
+}
+
+func (app *application) blockUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.updateRelation(w, r, app.store.Blocks.Block)
+}
+
+func (app *application) unblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.updateRelation(w, r, app.store.Blocks.Unblock)
+}
+
+func (app *application) muteUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.updateRelation(w, r, app.store.Blocks.Mute)
+}
+
+func (app *application) unmuteUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.updateRelation(w, r, app.store.Blocks.Unmute)
+}
+
+// updateRelation applies a block or mute change from the authenticated user
+// towards the user in the URL.
+func (app *application) updateRelation(w http.ResponseWriter, r *http.Request, update func(context.Context, int64, int64) error) {
+	authUser := getAuthUserFromContext(r)
+	targetUser := getUserFromContext(r)
+
+	if err := update(r.Context(), authUser.ID, targetUser.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrSelfBlock):
+			app.badRequestResponse(w, r, err)
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
 		case errors.Is(err, store.ErrConflict):
 			app.conflictResponse(w, r, err)
-			return
 		default:
 			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	_ = app.jsonResponse(w, http.StatusNoContent, nil)
+}
+
+type UpdateProfilePayload struct {
+	Username    *string `json:"username" validate:"omitnil,min=3,max=100"`
+	DisplayName *string `json:"display_name" validate:"omitempty,max=100"`
+	Bio         *string `json:"bio" validate:"omitempty,max=500"`
+	Location    *string `json:"location" validate:"omitempty,max=100"`
+	Website     *string `json:"website" validate:"omitempty,http_url,max=255"`
+	AvatarURL   *string `json:"avatar_url" validate:"omitempty,http_url,max=2048"`
+}
+
+func (app *application) updateMeHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromContext(r)
+
+	var payload UpdateProfilePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		validationErr := formatValidationErrors(err)
+		app.unprocessableEntityResponse(w, r, validationErr)
+		return
+	}
+
+	if payload.Username != nil && *payload.Username != user.Username {
+		if allowedAt := user.UsernameChangeAllowedAt(); time.Now().Before(allowedAt) {
+			app.unprocessableEntityResponse(w, r, map[string]string{
+				"username": fmt.Sprintf("Username can be changed again after %s", allowedAt.Format(time.RFC3339)),
+			})
 			return
 		}
+		user.Username = *payload.Username
+	}
+	if payload.DisplayName != nil {
+		user.DisplayName = *payload.DisplayName
+	}
+	if payload.Bio != nil {
+		user.Bio = *payload.Bio
+	}
+	if payload.Location != nil {
+		user.Location = *payload.Location
+	}
+	if payload.Website != nil {
+		user.Website = *payload.Website
+	}
+	if payload.AvatarURL != nil {
+		user.AvatarURL = *payload.AvatarURL
+	}
 
+	if err := app.store.Users.Update(r.Context(), user); err != nil {
+		switch {
+		case errors.Is(err, store.ErrDuplicateUsername):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
 	}
-	if err := app.jsonResponse(w, http.StatusOK, payload); err != nil {
+
+	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
 		app.internalServerError(w, r, err)
 	}
 }
 
-func (app *application) unFollowUserHandler(w http.ResponseWriter, r *http.Request) {
-	unfollowedUser := getUserFromContext(r)
-	var payload FollowUser
+type UpdatePrivacyPayload struct {
+	IsPrivate *bool `json:"is_private" validate:"required"`
+}
+
+func (app *application) updatePrivacyHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromContext(r)
 
+	var payload UpdatePrivacyPayload
 	if err := readJSON(w, r, &payload); err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
 
-	ctx := r.Context()
-	err := app.store.Followers.Unfollow(ctx, unfollowedUser.ID, payload.UserID)
+	if err := Validate.Struct(payload); err != nil {
+		validationErr := formatValidationErrors(err)
+		app.unprocessableEntityResponse(w, r, validationErr)
+		return
+	}
+
+	if err := app.store.Users.SetPrivate(r.Context(), user.ID, *payload.IsPrivate); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	user.IsPrivate = *payload.IsPrivate
+
+	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) getFollowRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromContext(r)
+
+	q := store.PaginatedQuery{
+		Limit: 20,
+		Sort:  "desc",
+	}
+
+	q, err := q.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(q); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	requests, pagination, err := app.store.Followers.GetFollowRequests(r.Context(), user.ID, q)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
-	if err := app.jsonResponse(w, http.StatusOK, payload); err != nil {
+
+	if err := app.paginatedJSONResponse(w, http.StatusOK, requests, pagination); err != nil {
 		app.internalServerError(w, r, err)
 	}
 }
 
+func (app *application) approveFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	app.resolveFollowRequest(w, r, app.store.Followers.ApproveFollowRequest)
+}
+
+func (app *application) rejectFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	app.resolveFollowRequest(w, r, app.store.Followers.RejectFollowRequest)
+}
+
+func (app *application) resolveFollowRequest(w http.ResponseWriter, r *http.Request, resolve func(context.Context, int64, int64) error) {
+	user := getAuthUserFromContext(r)
+
+	requesterID, err := strconv.ParseInt(chi.URLParam(r, "requesterID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := resolve(r.Context(), user.ID, requesterID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		case errors.Is(err, store.ErrConflict):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	_ = app.jsonResponse(w, http.StatusNoContent, nil)
+}
+
 func (app *application) userContextMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		paramId := chi.URLParam(r, "id")
+		paramId := chi.URLParam(r, "userID")
 		id, err := strconv.ParseInt(paramId, 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
 		ctx := r.Context()
 		user, err := app.store.Users.GetByID(ctx, id)
 		if err != nil {
@@ -112,6 +353,49 @@ func (app *application) userContextMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// usernameContextMiddleware loads the user named in the URL into the same
+// context key as userContextMiddleware, for profile links built from
+// usernames.
+func (app *application) usernameContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		user, err := app.store.Users.GetByUsername(ctx, chi.URLParam(r, "username"))
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+		valContext := context.WithValue(ctx, userCtxKey, user)
+		next.ServeHTTP(w, r.WithContext(valContext))
+	})
+}
+
+// unblockedUserMiddleware reports the user loaded by userContextMiddleware as
+// missing when they blocked the viewer or were blocked by them.
+func (app *application) unblockedUserMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := getUserFromContext(r)
+
+		if viewer := viewerID(r); viewer != 0 {
+			blocked, err := app.store.Blocks.IsBlocked(r.Context(), viewer, user.ID)
+			if err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
+			if blocked {
+				app.notFoundResponse(w, r, fmt.Errorf("user %d not found", user.ID))
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func getUserFromContext(r *http.Request) *store.User {
 	user, _ := r.Context().Value(userCtxKey).(*store.User)
 	return user
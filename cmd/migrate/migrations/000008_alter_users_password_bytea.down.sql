@@ -0,0 +1,2 @@
+ALTER TABLE users
+    ALTER COLUMN password TYPE varchar USING convert_from(password, 'UTF8');
\ No newline at end of file
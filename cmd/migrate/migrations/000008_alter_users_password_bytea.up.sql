@@ -0,0 +1,2 @@
+ALTER TABLE users
+    ALTER COLUMN password TYPE bytea USING convert_to(password, 'UTF8');
\ No newline at end of file
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS user_invitations;
+
+ALTER TABLE users
+DROP COLUMN is_active;
@@ -0,0 +1,12 @@
+ALTER TABLE users
+ADD COLUMN is_active boolean NOT NULL DEFAULT FALSE;
+
+UPDATE users SET is_active = TRUE;
+
+CREATE TABLE IF NOT EXISTS user_invitations (
+    token bytea PRIMARY KEY,
+    user_id bigint NOT NULL,
+    expiry timestamp(0) with time zone NOT NULL,
+
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS roles (
+    id bigserial PRIMARY KEY,
+    name varchar(255) NOT NULL UNIQUE,
+    level int NOT NULL DEFAULT 0,
+    description text
+);
+
+INSERT INTO roles (name, level, description)
+VALUES
+    ('user', 1, 'A user can create posts and comments'),
+    ('moderator', 2, 'A moderator can update other users posts'),
+    ('admin', 3, 'An admin can update and delete other users posts');
+
+ALTER TABLE users
+ADD COLUMN role_id bigint REFERENCES roles (id) DEFAULT 1;
+
+UPDATE users
+SET role_id = (SELECT id FROM roles WHERE name = 'user');
+
+ALTER TABLE users
+ALTER COLUMN role_id DROP DEFAULT;
+
+ALTER TABLE users
+ALTER COLUMN role_id SET NOT NULL;
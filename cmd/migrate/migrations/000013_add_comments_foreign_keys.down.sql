@@ -0,0 +1,3 @@
+ALTER TABLE comments
+DROP CONSTRAINT IF EXISTS fk_comments_user_id,
+DROP CONSTRAINT IF EXISTS fk_comments_post_id;
@@ -0,0 +1,14 @@
+DELETE FROM comments
+WHERE post_id NOT IN (SELECT id FROM posts)
+   OR user_id NOT IN (SELECT id FROM users);
+
+ALTER TABLE comments
+ALTER COLUMN post_id DROP DEFAULT,
+ALTER COLUMN user_id DROP DEFAULT;
+
+DROP SEQUENCE IF EXISTS comments_post_id_seq;
+DROP SEQUENCE IF EXISTS comments_user_id_seq;
+
+ALTER TABLE comments
+ADD CONSTRAINT fk_comments_post_id FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
+ADD CONSTRAINT fk_comments_user_id FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_followers_follower_id;
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS following_count,
+DROP COLUMN IF EXISTS followers_count;
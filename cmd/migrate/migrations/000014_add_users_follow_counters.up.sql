@@ -0,0 +1,9 @@
+ALTER TABLE users
+ADD COLUMN followers_count bigint NOT NULL DEFAULT 0,
+ADD COLUMN following_count bigint NOT NULL DEFAULT 0;
+
+UPDATE users u
+SET followers_count = (SELECT COUNT(*) FROM followers f WHERE f.user_id = u.id),
+    following_count = (SELECT COUNT(*) FROM followers f WHERE f.follower_id = u.id);
+
+CREATE INDEX IF NOT EXISTS idx_followers_follower_id ON followers (follower_id);
@@ -0,0 +1,2 @@
+ALTER TABLE followers
+DROP CONSTRAINT IF EXISTS chk_followers_no_self_follow;
@@ -0,0 +1,8 @@
+DELETE FROM followers WHERE user_id = follower_id;
+
+UPDATE users u
+SET followers_count = (SELECT COUNT(*) FROM followers f WHERE f.user_id = u.id),
+    following_count = (SELECT COUNT(*) FROM followers f WHERE f.follower_id = u.id);
+
+ALTER TABLE followers
+ADD CONSTRAINT chk_followers_no_self_follow CHECK (user_id <> follower_id);
@@ -0,0 +1,12 @@
+DROP INDEX IF EXISTS idx_media_unprocessed;
+
+ALTER TABLE media
+DROP CONSTRAINT IF EXISTS chk_media_status,
+DROP COLUMN IF EXISTS processing_started_at,
+DROP COLUMN IF EXISTS error,
+DROP COLUMN IF EXISTS attempts,
+DROP COLUMN IF EXISTS thumbnail_key,
+DROP COLUMN IF EXISTS blurhash,
+DROP COLUMN IF EXISTS height,
+DROP COLUMN IF EXISTS width,
+DROP COLUMN IF EXISTS status;
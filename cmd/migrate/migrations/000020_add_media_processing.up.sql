@@ -0,0 +1,12 @@
+ALTER TABLE media
+ADD COLUMN status varchar(20) NOT NULL DEFAULT 'pending',
+ADD COLUMN width int,
+ADD COLUMN height int,
+ADD COLUMN blurhash varchar(100),
+ADD COLUMN thumbnail_key text UNIQUE,
+ADD COLUMN attempts int NOT NULL DEFAULT 0,
+ADD COLUMN error text,
+ADD COLUMN processing_started_at timestamp(0) with time zone,
+ADD CONSTRAINT chk_media_status CHECK (status IN ('pending', 'processing', 'ready', 'failed'));
+
+CREATE INDEX IF NOT EXISTS idx_media_unprocessed ON media (id) WHERE status IN ('pending', 'processing');
@@ -0,0 +1,4 @@
+ALTER TABLE posts
+DROP COLUMN IF EXISTS likes_count;
+
+DROP TABLE IF EXISTS post_likes;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS post_likes (
+    post_id bigint NOT NULL,
+    user_id bigint NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (post_id, user_id),
+    FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_likes_user_id ON post_likes (user_id);
+
+ALTER TABLE posts
+ADD COLUMN likes_count int NOT NULL DEFAULT 0;
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS bookmark_folders (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    name varchar(100) NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+    UNIQUE (user_id, name),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS bookmarks (
+    user_id bigint NOT NULL,
+    post_id bigint NOT NULL,
+    folder_id bigint,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (user_id, post_id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
+    FOREIGN KEY (folder_id) REFERENCES bookmark_folders (id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_bookmarks_user_id_created_at ON bookmarks (user_id, created_at DESC, post_id DESC);
+CREATE INDEX IF NOT EXISTS idx_bookmarks_folder_id ON bookmarks (folder_id);
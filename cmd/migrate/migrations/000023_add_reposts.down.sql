@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_posts_repost_of_id;
+DROP INDEX IF EXISTS idx_posts_user_id_repost_of_id;
+
+DELETE FROM posts WHERE repost_of_id IS NOT NULL;
+
+ALTER TABLE posts
+DROP CONSTRAINT IF EXISTS chk_posts_single_reference,
+DROP COLUMN IF EXISTS quoted_post_id,
+DROP COLUMN IF EXISTS repost_of_id;
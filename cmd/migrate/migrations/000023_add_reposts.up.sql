@@ -0,0 +1,9 @@
+-- quoted_post_id deliberately has no foreign key: quotes outlive the post
+-- they quote and render it as unavailable instead
+ALTER TABLE posts
+ADD COLUMN repost_of_id bigint REFERENCES posts (id) ON DELETE CASCADE,
+ADD COLUMN quoted_post_id bigint,
+ADD CONSTRAINT chk_posts_single_reference CHECK (repost_of_id IS NULL OR quoted_post_id IS NULL);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_posts_user_id_repost_of_id ON posts (user_id, repost_of_id) WHERE repost_of_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_posts_repost_of_id ON posts (repost_of_id) WHERE repost_of_id IS NOT NULL;
@@ -0,0 +1,9 @@
+DELETE FROM posts WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_posts_user_id_repost_of_id;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_posts_user_id_repost_of_id ON posts (user_id, repost_of_id) WHERE repost_of_id IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_posts_deleted_at;
+
+ALTER TABLE posts
+DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,8 @@
+ALTER TABLE posts
+ADD COLUMN deleted_at timestamp(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS idx_posts_deleted_at ON posts (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- a deleted repost must not keep the user from reposting the post again
+DROP INDEX IF EXISTS idx_posts_user_id_repost_of_id;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_posts_user_id_repost_of_id ON posts (user_id, repost_of_id) WHERE repost_of_id IS NOT NULL AND deleted_at IS NULL;
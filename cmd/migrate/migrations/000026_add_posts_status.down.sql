@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_posts_unpublished_user_id;
+DROP INDEX IF EXISTS idx_posts_scheduled_publish_at;
+
+DELETE FROM posts WHERE status <> 'published';
+
+ALTER TABLE posts
+DROP CONSTRAINT IF EXISTS chk_posts_scheduled_publish_at,
+DROP CONSTRAINT IF EXISTS chk_posts_status,
+DROP COLUMN IF EXISTS publish_at,
+DROP COLUMN IF EXISTS status;
@@ -0,0 +1,8 @@
+ALTER TABLE posts
+ADD COLUMN status varchar(20) NOT NULL DEFAULT 'published',
+ADD COLUMN publish_at timestamp(0) with time zone,
+ADD CONSTRAINT chk_posts_status CHECK (status IN ('draft', 'scheduled', 'published')),
+ADD CONSTRAINT chk_posts_scheduled_publish_at CHECK (status <> 'scheduled' OR publish_at IS NOT NULL);
+
+CREATE INDEX IF NOT EXISTS idx_posts_scheduled_publish_at ON posts (publish_at) WHERE status = 'scheduled';
+CREATE INDEX IF NOT EXISTS idx_posts_unpublished_user_id ON posts (user_id, created_at) WHERE status <> 'published';
@@ -0,0 +1,8 @@
+ALTER TABLE posts
+ADD COLUMN edited_at timestamp(0) with time zone;
+
+-- a post was edited once one of its published versions got superseded
+UPDATE posts p SET edited_at = p.updated_at
+WHERE p.status = 'published' AND EXISTS (
+    SELECT 1 FROM post_revisions r WHERE r.post_id = p.id AND r.created_at >= p.created_at
+);
@@ -0,0 +1,2 @@
+ALTER TABLE media
+DROP COLUMN IF EXISTS next_attempt_at;
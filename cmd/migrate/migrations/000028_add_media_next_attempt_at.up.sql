@@ -0,0 +1,2 @@
+ALTER TABLE media
+ADD COLUMN next_attempt_at timestamp(0) with time zone;
@@ -0,0 +1,7 @@
+ALTER TABLE post_revisions
+ADD COLUMN status varchar(20) NOT NULL DEFAULT 'published';
+
+-- versions written before the post got published were drafts or scheduled
+UPDATE post_revisions r SET status = 'draft'
+FROM posts p
+WHERE p.id = r.post_id AND (p.status <> 'published' OR r.created_at < p.created_at);
@@ -100,7 +100,11 @@ var postComments = []string{
 func Seed(store store.Storage) {
 	ctx := context.Background()
 
-	users := generateUsers(50)
+	users, err := generateUsers(50)
+	if err != nil {
+		log.Println("Error generating users", err)
+		return
+	}
 
 	for _, user := range users {
 		if err := store.Users.Create(ctx, user); err != nil {
@@ -129,16 +133,19 @@ func Seed(store store.Storage) {
 
 }
 
-func generateUsers(count int) []*store.User {
+func generateUsers(count int) ([]*store.User, error) {
 	users := make([]*store.User, count)
 	for i := 0; i < count; i++ {
 		users[i] = &store.User{
 			Username: usernames[i%len(users)] + fmt.Sprintf("%d", i),
 			Email:    usernames[i%len(users)] + fmt.Sprintf("%d", i) + "@example.com",
-			Password: "password",
+			IsActive: true,
+		}
+		if err := users[i].Password.Set("password"); err != nil {
+			return nil, err
 		}
 	}
-	return users
+	return users, nil
 }
 
 func generatePosts(count int, users []*store.User) []*store.Post {
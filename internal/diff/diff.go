@@ -0,0 +1,146 @@
+// Package diff computes line-level differences between two texts.
+package diff
+
+import "strings"
+
+const (
+	OpEqual  = "equal"
+	OpInsert = "insert"
+	OpDelete = "delete"
+)
+
+// MaxEdits bounds the edit distance searched for. Texts further apart than
+// that are reported as a replacement of everything between their common
+// prefix and suffix, which keeps memory at O(MaxEdits²) whatever the input.
+const MaxEdits = 1000
+
+// Line is a single line of a diff, tagged with how it changed from the old
+// text to the new one.
+type Line struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// Lines returns the shortest edit script turning a into b, line by line,
+// using Myers' O((N+M)D) algorithm.
+func Lines(a, b string) []Line {
+	x, y := split(a), split(b)
+
+	// common prefix and suffix don't take part in the search
+	prefix := 0
+	for prefix < len(x) && prefix < len(y) && x[prefix] == y[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(x)-prefix && suffix < len(y)-prefix && x[len(x)-1-suffix] == y[len(y)-1-suffix] {
+		suffix++
+	}
+
+	lines := []Line{}
+	for _, text := range x[:prefix] {
+		lines = append(lines, Line{Op: OpEqual, Text: text})
+	}
+	lines = append(lines, middle(x[prefix:len(x)-suffix], y[prefix:len(y)-suffix])...)
+	for _, text := range x[len(x)-suffix:] {
+		lines = append(lines, Line{Op: OpEqual, Text: text})
+	}
+	return lines
+}
+
+func middle(x, y []string) []Line {
+	n, m := len(x), len(y)
+	maxD := min(n+m, MaxEdits)
+	offset := maxD + 1
+
+	// v[k+offset] is the furthest x reached on diagonal k; trace keeps the
+	// window v[-d..d] per edit distance d to walk the path back afterwards
+	v := make([]int, 2*maxD+3)
+	var trace [][]int
+
+	for d := 0; d <= maxD; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+
+		for k := -d; k <= d; k += 2 {
+			var i int
+			if k == -d || (k != d && v[k-1+offset] < v[k+1+offset]) {
+				i = v[k+1+offset] // down: insertion
+			} else {
+				i = v[k-1+offset] + 1 // right: deletion
+			}
+			j := i - k
+			for i < n && j < m && x[i] == y[j] {
+				i++
+				j++
+			}
+			v[k+offset] = i
+
+			if i >= n && j >= m {
+				return backtrack(x, y, trace, d, k)
+			}
+		}
+	}
+
+	return replace(x, y)
+}
+
+func backtrack(x, y []string, trace [][]int, d, k int) []Line {
+	lines := []Line{}
+	i, j := len(x), len(y)
+
+	for ; d > 0; d-- {
+		// trace[d] holds v[-d..d], so diagonal k sits at index k+d
+		v := trace[d]
+		var prevK int
+		if k == -d || (k != d && v[k-1+d] < v[k+1+d]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevI := v[prevK+d]
+		prevJ := prevI - prevK
+
+		for i > prevI && j > prevJ {
+			i--
+			j--
+			lines = append(lines, Line{Op: OpEqual, Text: x[i]})
+		}
+		if i == prevI {
+			j--
+			lines = append(lines, Line{Op: OpInsert, Text: y[j]})
+		} else {
+			i--
+			lines = append(lines, Line{Op: OpDelete, Text: x[i]})
+		}
+		k = prevK
+	}
+
+	for i > 0 && j > 0 {
+		i--
+		j--
+		lines = append(lines, Line{Op: OpEqual, Text: x[i]})
+	}
+
+	for l, r := 0, len(lines)-1; l < r; l, r = l+1, r-1 {
+		lines[l], lines[r] = lines[r], lines[l]
+	}
+	return lines
+}
+
+// replace deletes all of x and inserts all of y.
+func replace(x, y []string) []Line {
+	lines := make([]Line, 0, len(x)+len(y))
+	for _, text := range x {
+		lines = append(lines, Line{Op: OpDelete, Text: text})
+	}
+	for _, text := range y {
+		lines = append(lines, Line{Op: OpInsert, Text: text})
+	}
+	return lines
+}
+
+func split(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+}
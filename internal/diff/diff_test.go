@@ -0,0 +1,170 @@
+package diff
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []Line
+	}{
+		{
+			name: "both empty",
+			want: []Line{},
+		},
+		{
+			name: "identical",
+			a:    "one\ntwo",
+			b:    "one\ntwo",
+			want: []Line{{OpEqual, "one"}, {OpEqual, "two"}},
+		},
+		{
+			name: "from empty",
+			b:    "one\ntwo",
+			want: []Line{{OpInsert, "one"}, {OpInsert, "two"}},
+		},
+		{
+			name: "to empty",
+			a:    "one\ntwo",
+			want: []Line{{OpDelete, "one"}, {OpDelete, "two"}},
+		},
+		{
+			name: "line changed in the middle",
+			a:    "one\ntwo\nthree",
+			b:    "one\n2\nthree",
+			want: []Line{{OpEqual, "one"}, {OpDelete, "two"}, {OpInsert, "2"}, {OpEqual, "three"}},
+		},
+		{
+			name: "line inserted",
+			a:    "one\nthree",
+			b:    "one\ntwo\nthree",
+			want: []Line{{OpEqual, "one"}, {OpInsert, "two"}, {OpEqual, "three"}},
+		},
+		{
+			name: "line deleted",
+			a:    "one\ntwo\nthree",
+			b:    "one\nthree",
+			want: []Line{{OpEqual, "one"}, {OpDelete, "two"}, {OpEqual, "three"}},
+		},
+		{
+			name: "crlf line endings",
+			a:    "one\r\ntwo",
+			b:    "one\ntwo",
+			want: []Line{{OpEqual, "one"}, {OpEqual, "two"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Lines(tt.a, tt.b)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lines(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinesShortest(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+	}{
+		{"abcabba to cbabac", "a\nb\nc\na\nb\nb\na", "c\nb\na\nb\na\nc"},
+		{"reordered", "a\nb\nc\nd", "d\nc\nb\na"},
+		{"repeated lines", "x\nx\ny\nx", "x\ny\nx\nx\ny"},
+		{"disjoint", "a\nb", "c\nd\ne"},
+		{"interleaved", "1\n2\n3\n4\n5\n6", "0\n2\n3\n7\n5\n6\n8"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := Lines(tt.a, tt.b)
+			x, y := split(tt.a), split(tt.b)
+
+			assertReconstructs(t, lines, x, y)
+
+			edits := 0
+			for _, l := range lines {
+				if l.Op != OpEqual {
+					edits++
+				}
+			}
+			if want := len(x) + len(y) - 2*lcs(x, y); edits != want {
+				t.Errorf("got %d edits, want %d", edits, want)
+			}
+		})
+	}
+}
+
+func TestLinesBeyondMaxEdits(t *testing.T) {
+	var a, b []string
+	for i := range MaxEdits {
+		a = append(a, "a"+strings.Repeat("x", i%7))
+		b = append(b, "b"+strings.Repeat("y", i%5))
+	}
+	x := "head\n" + strings.Join(a, "\n") + "\ntail"
+	y := "head\n" + strings.Join(b, "\n") + "\ntail"
+
+	lines := Lines(x, y)
+	assertReconstructs(t, lines, split(x), split(y))
+
+	// everything between the common prefix and suffix is replaced wholesale
+	for i, l := range lines[1 : len(lines)-1] {
+		want := OpDelete
+		if i >= len(a) {
+			want = OpInsert
+		}
+		if l.Op != want {
+			t.Fatalf("line %d is %s, want %s", i+1, l.Op, want)
+		}
+	}
+}
+
+// assertReconstructs checks that the diff yields x when insertions are
+// skipped and y when deletions are.
+func assertReconstructs(t *testing.T, lines []Line, x, y []string) {
+	t.Helper()
+
+	var old, cur []string
+	for _, l := range lines {
+		switch l.Op {
+		case OpEqual:
+			old = append(old, l.Text)
+			cur = append(cur, l.Text)
+		case OpDelete:
+			old = append(old, l.Text)
+		case OpInsert:
+			cur = append(cur, l.Text)
+		default:
+			t.Fatalf("unknown op %q", l.Op)
+		}
+	}
+
+	if !reflect.DeepEqual(old, x) {
+		t.Errorf("old text = %q, want %q", old, x)
+	}
+	if !reflect.DeepEqual(cur, y) {
+		t.Errorf("new text = %q, want %q", cur, y)
+	}
+}
+
+func lcs(x, y []string) int {
+	dp := make([][]int, len(x)+1)
+	for i := range dp {
+		dp[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				dp[i][j] = dp[i+1][j+1] + 1
+			} else {
+				dp[i][j] = max(dp[i+1][j], dp[i][j+1])
+			}
+		}
+	}
+	return dp[0][0]
+}
@@ -0,0 +1,165 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/buckket/go-blurhash"
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+// MaxPixels guards against decompression bombs: small files that declare huge
+// dimensions and exhaust memory once decoded.
+const MaxPixels = 50_000_000
+
+var ErrInvalidImage = errors.New("imaging: unsupported or corrupt image")
+
+// Result is the outcome of processing an uploaded image.
+type Result struct {
+	// Image is the original with its metadata removed.
+	Image                []byte
+	Thumbnail            []byte
+	ThumbnailContentType string
+	Width                int
+	Height               int
+	Blurhash             string
+}
+
+// Process strips EXIF/GPS and other metadata from data, generates a thumbnail
+// fitting in a thumbSize square and computes the blurhash placeholder. The
+// reported dimensions account for the EXIF orientation of JPEGs.
+func Process(data []byte, contentType string, thumbSize int) (*Result, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	if cfg.Width*cfg.Height > MaxPixels {
+		return nil, fmt.Errorf("%w: %dx%d exceeds %d pixels", ErrInvalidImage, cfg.Width, cfg.Height, MaxPixels)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+
+	orientation := 1
+	if contentType == "image/jpeg" {
+		orientation = jpegOrientation(data)
+	}
+	img = orient(img, orientation)
+
+	res := &Result{
+		Width:  img.Bounds().Dx(),
+		Height: img.Bounds().Dy(),
+	}
+
+	// dropping the orientation tag would leave the picture sideways, so
+	// rotated JPEGs are re-encoded upright instead of stripped in place
+	if orientation != 1 {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+			return nil, err
+		}
+		res.Image = buf.Bytes()
+	} else {
+		res.Image, err = Strip(data, contentType)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	thumb := resize(img, thumbSize, thumbSize)
+	var buf bytes.Buffer
+	switch contentType {
+	case "image/jpeg":
+		err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 80})
+		res.ThumbnailContentType = "image/jpeg"
+	default:
+		// keep transparency for the other formats
+		err = png.Encode(&buf, thumb)
+		res.ThumbnailContentType = "image/png"
+	}
+	if err != nil {
+		return nil, err
+	}
+	res.Thumbnail = buf.Bytes()
+
+	// the hash only captures a handful of frequencies, so encoding a tiny
+	// copy gives the same result for a fraction of the work
+	hash, err := blurhash.Encode(4, 3, resize(img, 32, 32))
+	if err != nil {
+		return nil, err
+	}
+	res.Blurhash = hash
+
+	return res, nil
+}
+
+// resize scales img down to fit within maxW x maxH, preserving the aspect
+// ratio. Images that already fit are only converted to RGBA.
+func resize(img image.Image, maxW, maxH int) *image.RGBA {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	if w > maxW || h > maxH {
+		if w*maxH > h*maxW {
+			w, h = maxW, max(1, h*maxW/w)
+		} else {
+			w, h = max(1, w*maxH/h), maxH
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	if w == b.Dx() && h == b.Dy() {
+		draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+		return dst
+	}
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, b, xdraw.Src, nil)
+	return dst
+}
+
+// orient applies the EXIF orientation o (1-8) so the image is upright.
+func orient(src image.Image, o int) image.Image {
+	if o < 2 || o > 8 {
+		return src
+	}
+
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if o >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch o {
+			case 2: // mirrored horizontally
+				dx, dy = w-1-x, y
+			case 3: // rotated 180
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // rotated 90 clockwise
+				dx, dy = h-1-y, x
+			case 7: // transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90 counter-clockwise
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, src.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,323 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Strip removes EXIF, XMP, IPTC, comments and other textual metadata from
+// an encoded image without re-encoding the pixel data.
+func Strip(data []byte, contentType string) ([]byte, error) {
+	switch contentType {
+	case "image/jpeg":
+		return stripJPEG(data)
+	case "image/png":
+		return stripPNG(data)
+	case "image/webp":
+		return stripWebP(data)
+	case "image/gif":
+		return stripGIF(data)
+	default:
+		return nil, fmt.Errorf("%w: cannot strip %s", ErrInvalidImage, contentType)
+	}
+}
+
+// keptJPEGMarkers lists the application segments needed to render the image
+// correctly: JFIF (APP0), ICC colour profiles (APP2) and the Adobe colour
+// transform (APP14). Every other APPn segment and comments are dropped.
+var keptJPEGMarkers = map[byte]bool{
+	0xE0: true,
+	0xE2: true,
+	0xEE: true,
+}
+
+func stripJPEG(data []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, fmt.Errorf("%w: missing JPEG SOI marker", ErrInvalidImage)
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:2]...)
+
+	i := 2
+	for i < len(data) {
+		if data[i] != 0xFF {
+			return nil, fmt.Errorf("%w: malformed JPEG segment at %d", ErrInvalidImage, i)
+		}
+		// markers may be preceded by any number of fill bytes
+		for i+1 < len(data) && data[i+1] == 0xFF {
+			i++
+		}
+		if i+1 >= len(data) {
+			return nil, fmt.Errorf("%w: truncated JPEG", ErrInvalidImage)
+		}
+
+		marker := data[i+1]
+		switch {
+		case marker == 0xDA || marker == 0xD9:
+			// start of scan: the rest is entropy coded data up to EOI
+			return append(out, data[i:]...), nil
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7):
+			// standalone markers carry no length
+			out = append(out, data[i:i+2]...)
+			i += 2
+			continue
+		}
+
+		if i+4 > len(data) {
+			return nil, fmt.Errorf("%w: truncated JPEG", ErrInvalidImage)
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 {
+			return nil, fmt.Errorf("%w: malformed JPEG segment at %d", ErrInvalidImage, i)
+		}
+		end := i + 2 + length
+		if end > len(data) {
+			return nil, fmt.Errorf("%w: truncated JPEG", ErrInvalidImage)
+		}
+
+		isMetadata := (marker >= 0xE0 && marker <= 0xEF && !keptJPEGMarkers[marker]) || marker == 0xFE
+		if !isMetadata {
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+
+	return nil, fmt.Errorf("%w: JPEG has no image data", ErrInvalidImage)
+}
+
+// strippedPNGChunks are the ancillary chunks holding metadata.
+var strippedPNGChunks = map[string]bool{
+	"eXIf": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"tIME": true,
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+func stripPNG(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, fmt.Errorf("%w: missing PNG signature", ErrInvalidImage)
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, pngSignature...)
+
+	i := len(pngSignature)
+	for i < len(data) {
+		if i+8 > len(data) {
+			return nil, fmt.Errorf("%w: truncated PNG", ErrInvalidImage)
+		}
+		// length, type, data and CRC
+		end := i + 12 + int(binary.BigEndian.Uint32(data[i:]))
+		if end > len(data) || end < i {
+			return nil, fmt.Errorf("%w: truncated PNG", ErrInvalidImage)
+		}
+
+		chunkType := string(data[i+4 : i+8])
+		if !strippedPNGChunks[chunkType] {
+			out = append(out, data[i:end]...)
+		}
+		i = end
+
+		if chunkType == "IEND" {
+			return out, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: PNG has no IEND chunk", ErrInvalidImage)
+}
+
+// keptGIFApplications lists the application extensions needed to render the
+// image correctly: animation loop counts and ICC colour profiles. Every other
+// application extension, such as XMP, and comments are dropped.
+var keptGIFApplications = map[string]bool{
+	"NETSCAPE2.0": true,
+	"ANIMEXTS1.0": true,
+	"ICCRGBG1012": true,
+}
+
+func stripGIF(data []byte) ([]byte, error) {
+	if len(data) < 13 || (string(data[:6]) != "GIF87a" && string(data[:6]) != "GIF89a") {
+		return nil, fmt.Errorf("%w: missing GIF header", ErrInvalidImage)
+	}
+
+	// header, logical screen descriptor and global colour table
+	i := 13
+	if data[10]&0x80 != 0 {
+		i += 3 << (data[10]&0x07 + 1)
+	}
+	if i > len(data) {
+		return nil, fmt.Errorf("%w: truncated GIF", ErrInvalidImage)
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:i]...)
+
+	for i < len(data) {
+		start := i
+		keep := true
+
+		switch data[i] {
+		case 0x3B:
+			// trailer
+			return append(out, data[i]), nil
+		case 0x21:
+			if i+2 > len(data) {
+				return nil, fmt.Errorf("%w: truncated GIF", ErrInvalidImage)
+			}
+			switch data[i+1] {
+			case 0xFE:
+				keep = false
+			case 0xFF:
+				// the identifier is the first sub-block
+				if i+3 > len(data) || i+3+int(data[i+2]) > len(data) {
+					return nil, fmt.Errorf("%w: truncated GIF", ErrInvalidImage)
+				}
+				keep = keptGIFApplications[string(data[i+3:i+3+int(data[i+2])])]
+			}
+			i += 2
+		case 0x2C:
+			// image descriptor, local colour table and LZW code size
+			if i+10 > len(data) {
+				return nil, fmt.Errorf("%w: truncated GIF", ErrInvalidImage)
+			}
+			packed := data[i+9]
+			i += 10
+			if packed&0x80 != 0 {
+				i += 3 << (packed&0x07 + 1)
+			}
+			i++
+		default:
+			return nil, fmt.Errorf("%w: malformed GIF block at %d", ErrInvalidImage, i)
+		}
+
+		// data sub-blocks up to the zero length terminator
+		for {
+			if i >= len(data) {
+				return nil, fmt.Errorf("%w: truncated GIF", ErrInvalidImage)
+			}
+			size := int(data[i])
+			i += 1 + size
+			if size == 0 {
+				break
+			}
+		}
+		if i > len(data) {
+			return nil, fmt.Errorf("%w: truncated GIF", ErrInvalidImage)
+		}
+
+		if keep {
+			out = append(out, data[start:i]...)
+		}
+	}
+
+	return nil, fmt.Errorf("%w: GIF has no trailer", ErrInvalidImage)
+}
+
+const (
+	webpXMPFlag  = 0x04
+	webpEXIFFlag = 0x08
+)
+
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, fmt.Errorf("%w: missing WebP header", ErrInvalidImage)
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:12]...)
+
+	i := 12
+	for i+8 <= len(data) {
+		fourCC := string(data[i : i+4])
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		// chunks are padded to an even size
+		end := i + 8 + size + size&1
+		if end > len(data) || end < i {
+			return nil, fmt.Errorf("%w: truncated WebP", ErrInvalidImage)
+		}
+
+		switch fourCC {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			start := len(out)
+			out = append(out, data[i:end]...)
+			if size > 0 {
+				out[start+8] &^= webpEXIFFlag | webpXMPFlag
+			}
+		default:
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, nil
+}
+
+// jpegOrientation returns the EXIF orientation tag of a JPEG, or 1 when it is
+// missing or unreadable.
+func jpegOrientation(data []byte) int {
+	i := 2
+	for i+4 <= len(data) && data[i] == 0xFF {
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+		// the length covers itself, anything shorter is corrupt
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			break
+		}
+		if marker == 0xE1 && bytes.HasPrefix(data[i+4:end], []byte("Exif\x00\x00")) {
+			return exifOrientation(data[i+10 : end])
+		}
+		i = end
+	}
+
+	return 1
+}
+
+// exifOrientation reads tag 0x0112 from IFD0 of a TIFF structured EXIF blob.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+
+	entries := int(order.Uint16(tiff[ifd:]))
+	for n := 0; n < entries; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			o := int(order.Uint16(tiff[entry+8:]))
+			if o < 1 || o > 8 {
+				return 1
+			}
+			return o
+		}
+	}
+
+	return 1
+}
@@ -0,0 +1,359 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+func TestStripJPEG(t *testing.T) {
+	soi := []byte{0xFF, 0xD8}
+	sos := []byte{0xFF, 0xDA, 0x00, 0x02, 0x12, 0x34, 0xFF, 0xD9}
+	jfif := jpegSegment(0xE0, []byte("JFIF\x00"))
+	exif := jpegSegment(0xE1, []byte("Exif\x00\x00secret"))
+	icc := jpegSegment(0xE2, []byte("ICC_PROFILE\x00"))
+	comment := jpegSegment(0xFE, []byte("taken at home"))
+	dqt := jpegSegment(0xDB, []byte{0x00, 0x01})
+
+	tests := []struct {
+		name    string
+		in      []byte
+		want    []byte
+		wantErr bool
+	}{
+		{
+			name: "drops exif and comments",
+			in:   concat(soi, jfif, exif, comment, dqt, sos),
+			want: concat(soi, jfif, dqt, sos),
+		},
+		{
+			name: "keeps colour profiles",
+			in:   concat(soi, icc, exif, sos),
+			want: concat(soi, icc, sos),
+		},
+		{
+			name: "skips fill bytes before markers",
+			in:   concat(soi, []byte{0xFF}, exif, sos),
+			want: concat(soi, sos),
+		},
+		{
+			name:    "missing SOI",
+			in:      concat(jfif, sos),
+			wantErr: true,
+		},
+		{
+			name:    "segment shorter than its length field",
+			in:      concat(soi, []byte{0xFF, 0xE1, 0x00, 0x00}, sos),
+			wantErr: true,
+		},
+		{
+			name:    "segment running past the end",
+			in:      concat(soi, []byte{0xFF, 0xE1, 0x10, 0x00, 0x00}),
+			wantErr: true,
+		},
+		{
+			name:    "no scan",
+			in:      concat(soi, jfif),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Strip(tt.in, "image/jpeg")
+			assertStripped(t, got, err, tt.want, tt.wantErr)
+		})
+	}
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	soi := []byte{0xFF, 0xD8}
+	sos := []byte{0xFF, 0xDA, 0x00, 0x02}
+
+	tests := []struct {
+		name string
+		in   []byte
+		want int
+	}{
+		{
+			name: "little endian",
+			in:   concat(soi, jpegSegment(0xE1, exifWithOrientation(binary.LittleEndian, 6)), sos),
+			want: 6,
+		},
+		{
+			name: "big endian after another segment",
+			in:   concat(soi, jpegSegment(0xE0, []byte("JFIF\x00")), jpegSegment(0xE1, exifWithOrientation(binary.BigEndian, 3)), sos),
+			want: 3,
+		},
+		{
+			name: "out of range value",
+			in:   concat(soi, jpegSegment(0xE1, exifWithOrientation(binary.BigEndian, 9)), sos),
+			want: 1,
+		},
+		{
+			name: "no exif",
+			in:   concat(soi, sos),
+			want: 1,
+		},
+		{
+			name: "zero segment length",
+			in:   concat(soi, []byte{0xFF, 0xE1, 0x00, 0x00, 0xFF, 0xE1, 0x00, 0x00}),
+			want: 1,
+		},
+		{
+			name: "one byte segment length",
+			in:   concat(soi, []byte{0xFF, 0xE1, 0x00, 0x01, 0x00, 0x00}),
+			want: 1,
+		},
+		{
+			name: "truncated exif",
+			in:   concat(soi, jpegSegment(0xE1, []byte("Exif\x00\x00II*\x00")), sos),
+			want: 1,
+		},
+		{
+			name: "ifd offset past the end",
+			in:   concat(soi, jpegSegment(0xE1, []byte("Exif\x00\x00II*\x00\xFF\xFF\x00\x00")), sos),
+			want: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jpegOrientation(tt.in); got != tt.want {
+				t.Errorf("jpegOrientation() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripPNG(t *testing.T) {
+	ihdr := pngChunk("IHDR", make([]byte, 13))
+	idat := pngChunk("IDAT", []byte{1, 2, 3})
+	iend := pngChunk("IEND", nil)
+	text := pngChunk("tEXt", []byte("Author\x00someone"))
+	exif := pngChunk("eXIf", []byte("MM\x00*"))
+	iccp := pngChunk("iCCP", []byte("icc\x00\x00"))
+
+	tests := []struct {
+		name    string
+		in      []byte
+		want    []byte
+		wantErr bool
+	}{
+		{
+			name: "drops text and exif chunks",
+			in:   concat(pngSignature, ihdr, text, iccp, exif, idat, iend),
+			want: concat(pngSignature, ihdr, iccp, idat, iend),
+		},
+		{
+			name: "ignores data after IEND",
+			in:   concat(pngSignature, ihdr, idat, iend, []byte("trailing")),
+			want: concat(pngSignature, ihdr, idat, iend),
+		},
+		{
+			name:    "missing signature",
+			in:      concat(ihdr, idat, iend),
+			wantErr: true,
+		},
+		{
+			name:    "chunk running past the end",
+			in:      concat(pngSignature, ihdr, []byte{0xFF, 0xFF, 0xFF, 0xF0, 'I', 'D', 'A', 'T'}),
+			wantErr: true,
+		},
+		{
+			name:    "no IEND",
+			in:      concat(pngSignature, ihdr, idat),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Strip(tt.in, "image/png")
+			assertStripped(t, got, err, tt.want, tt.wantErr)
+		})
+	}
+}
+
+func TestStripGIF(t *testing.T) {
+	frame := image.NewPaletted(image.Rect(0, 0, 4, 4), color.Palette{color.Black, color.White})
+	var buf bytes.Buffer
+	err := gif.EncodeAll(&buf, &gif.GIF{Image: []*image.Paletted{frame, frame}, Delay: []int{10, 10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	animated := buf.Bytes()
+	body, trailer := animated[:len(animated)-1], animated[len(animated)-1:]
+
+	comment := []byte{0x21, 0xFE, 0x05, 'h', 'e', 'l', 'l', 'o', 0x00}
+	xmp := concat([]byte{0x21, 0xFF, 0x0B}, []byte("XMP DataXMP"), []byte{0x03, 'g', 'p', 's', 0x00})
+
+	tests := []struct {
+		name    string
+		in      []byte
+		want    []byte
+		wantErr bool
+	}{
+		{
+			name: "unchanged without metadata",
+			in:   animated,
+			want: animated,
+		},
+		{
+			name: "drops comments and XMP but keeps the loop extension",
+			in:   concat(body, comment, xmp, trailer),
+			want: animated,
+		},
+		{
+			name:    "missing header",
+			in:      animated[6:],
+			wantErr: true,
+		},
+		{
+			name:    "unterminated sub-blocks",
+			in:      concat(body, []byte{0x21, 0xFE, 0x05, 'h', 'e'}),
+			wantErr: true,
+		},
+		{
+			name:    "unknown block",
+			in:      concat(body, []byte{0x42}, trailer),
+			wantErr: true,
+		},
+		{
+			name:    "no trailer",
+			in:      body,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Strip(tt.in, "image/gif")
+			assertStripped(t, got, err, tt.want, tt.wantErr)
+			if err == nil {
+				if _, err := gif.DecodeAll(bytes.NewReader(got)); err != nil {
+					t.Errorf("stripped GIF does not decode: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestStripWebP(t *testing.T) {
+	vp8x := func(flags byte) []byte {
+		return riffChunk("VP8X", []byte{flags, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+	}
+	vp8 := riffChunk("VP8 ", []byte{1, 2, 3})
+	exif := riffChunk("EXIF", []byte("MM\x00*"))
+	xmp := riffChunk("XMP ", []byte("<x:xmpmeta/>"))
+	iccp := riffChunk("ICCP", []byte("icc"))
+
+	tests := []struct {
+		name    string
+		in      []byte
+		want    []byte
+		wantErr bool
+	}{
+		{
+			name: "drops metadata chunks and clears their flags",
+			in:   webp(vp8x(0x20|webpEXIFFlag|webpXMPFlag), iccp, vp8, exif, xmp),
+			want: webp(vp8x(0x20), iccp, vp8),
+		},
+		{
+			name: "simple format is unchanged",
+			in:   webp(vp8),
+			want: webp(vp8),
+		},
+		{
+			name:    "missing header",
+			in:      vp8,
+			wantErr: true,
+		},
+		{
+			name:    "chunk running past the end",
+			in:      webp([]byte{'V', 'P', '8', ' ', 0xFF, 0x00, 0x00, 0x00}),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Strip(tt.in, "image/webp")
+			assertStripped(t, got, err, tt.want, tt.wantErr)
+		})
+	}
+}
+
+func assertStripped(t *testing.T, got []byte, err error, want []byte, wantErr bool) {
+	t.Helper()
+
+	if wantErr {
+		if !errors.Is(err, ErrInvalidImage) {
+			t.Fatalf("got error %v, want ErrInvalidImage", err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got\n%x\nwant\n%x", got, want)
+	}
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func jpegSegment(marker byte, payload []byte) []byte {
+	segment := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// exifWithOrientation builds an APP1 payload whose IFD0 holds a single
+// orientation entry.
+func exifWithOrientation(order binary.ByteOrder, orientation uint16) []byte {
+	tiff := make([]byte, 8+2+12)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 1)
+	order.PutUint16(tiff[10:], 0x0112)
+	order.PutUint16(tiff[12:], 3)
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], orientation)
+	return concat([]byte("Exif\x00\x00"), tiff)
+}
+
+// pngChunk builds a chunk with a zero CRC, which stripping doesn't check.
+func pngChunk(chunkType string, payload []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(payload)))
+	chunk = append(chunk, chunkType...)
+	chunk = append(chunk, payload...)
+	return append(chunk, 0, 0, 0, 0)
+}
+
+func riffChunk(fourCC string, payload []byte) []byte {
+	chunk := binary.LittleEndian.AppendUint32([]byte(fourCC), uint32(len(payload)))
+	chunk = append(chunk, payload...)
+	if len(payload)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+func webp(chunks ...[]byte) []byte {
+	body := concat(chunks...)
+	out := binary.LittleEndian.AppendUint32([]byte("RIFF"), uint32(len(body)+4))
+	out = append(out, "WEBP"...)
+	return append(out, body...)
+}
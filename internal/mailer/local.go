@@ -0,0 +1,54 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileClient writes every email as an .eml file into a directory instead of
+// delivering it. Intended for development and tests.
+type FileClient struct {
+	fromEmail string
+	dir       string
+}
+
+func NewFileClient(dir, fromEmail string) (*FileClient, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &FileClient{fromEmail: fromEmail, dir: dir}, nil
+}
+
+func (c *FileClient) Send(ctx context.Context, templateFile, username, email string, data any) error {
+	msg, err := render(c.fromEmail, templateFile, username, email, data)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d_%s.eml", time.Now().UnixNano(), filepath.Base(msg.to))
+	return os.WriteFile(filepath.Join(c.dir, name), msg.raw, 0o644)
+}
+
+// LogClient prints every email to the standard logger instead of delivering it.
+type LogClient struct {
+	fromEmail string
+}
+
+func NewLogClient(fromEmail string) *LogClient {
+	return &LogClient{fromEmail: fromEmail}
+}
+
+func (c *LogClient) Send(ctx context.Context, templateFile, username, email string, data any) error {
+	msg, err := render(c.fromEmail, templateFile, username, email, data)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Email to %s subject %q:\n%s", msg.to, msg.subject, msg.raw)
+	return nil
+}
@@ -0,0 +1,114 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	texttemplate "text/template"
+	"time"
+)
+
+const (
+	UserInvitationTemplate = "user_invitation.tmpl"
+)
+
+//go:embed "templates"
+var FS embed.FS
+
+type Client interface {
+	Send(ctx context.Context, templateFile, username, email string, data any) error
+}
+
+// message is a rendered email ready to be handed over to a transport.
+type message struct {
+	from    string
+	to      string
+	subject string
+	raw     []byte
+}
+
+// render executes the "subject", "plainBody" and "htmlBody" blocks of the
+// given template and assembles them into a multipart/alternative message.
+func render(fromEmail, templateFile, username, email string, data any) (*message, error) {
+	path := "templates/" + templateFile
+
+	textTmpl, err := texttemplate.ParseFS(FS, path)
+	if err != nil {
+		return nil, err
+	}
+
+	subject := new(bytes.Buffer)
+	if err := textTmpl.ExecuteTemplate(subject, "subject", data); err != nil {
+		return nil, err
+	}
+
+	plainBody := new(bytes.Buffer)
+	if err := textTmpl.ExecuteTemplate(plainBody, "plainBody", data); err != nil {
+		return nil, err
+	}
+
+	htmlTmpl, err := htmltemplate.ParseFS(FS, path)
+	if err != nil {
+		return nil, err
+	}
+
+	htmlBody := new(bytes.Buffer)
+	if err := htmlTmpl.ExecuteTemplate(htmlBody, "htmlBody", data); err != nil {
+		return nil, err
+	}
+
+	to := (&mail.Address{Name: username, Address: email}).String()
+
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	if err := writePart(mw, "text/plain; charset=utf-8", plainBody.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := writePart(mw, "text/html; charset=utf-8", htmlBody.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	raw := new(bytes.Buffer)
+	fmt.Fprintf(raw, "From: %s\r\n", fromEmail)
+	fmt.Fprintf(raw, "To: %s\r\n", to)
+	fmt.Fprintf(raw, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject.String()))
+	fmt.Fprintf(raw, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(raw, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(raw, "Content-Type: multipart/alternative; boundary=%s\r\n", mw.Boundary())
+	fmt.Fprintf(raw, "\r\n")
+	raw.Write(body.Bytes())
+
+	return &message{
+		from:    fromEmail,
+		to:      email,
+		subject: subject.String(),
+		raw:     raw.Bytes(),
+	}, nil
+}
+
+func writePart(mw *multipart.Writer, contentType string, content []byte) error {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Transfer-Encoding", "quoted-printable")
+
+	part, err := mw.CreatePart(header)
+	if err != nil {
+		return err
+	}
+
+	qp := quotedprintable.NewWriter(part)
+	if _, err := qp.Write(content); err != nil {
+		return err
+	}
+	return qp.Close()
+}
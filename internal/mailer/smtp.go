@@ -0,0 +1,125 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+const maxRetries = 3
+
+type SMTPClient struct {
+	fromEmail string
+	host      string
+	addr      string
+	auth      smtp.Auth
+}
+
+func NewSMTPClient(host string, port int, username, password, fromEmail string) *SMTPClient {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &SMTPClient{
+		fromEmail: fromEmail,
+		host:      host,
+		addr:      net.JoinHostPort(host, strconv.Itoa(port)),
+		auth:      auth,
+	}
+}
+
+// Send delivers the email, retrying failed attempts with a growing delay. ctx
+// bounds the whole delivery, retries included.
+func (c *SMTPClient) Send(ctx context.Context, templateFile, username, email string, data any) error {
+	msg, err := render(c.fromEmail, templateFile, username, email, data)
+	if err != nil {
+		return err
+	}
+
+	// the envelope sender must be a bare address, FROM_EMAIL may carry a
+	// display name which only belongs in the From header
+	from, err := mail.ParseAddress(msg.from)
+	if err != nil {
+		return fmt.Errorf("invalid sender %q: %w", msg.from, err)
+	}
+
+	for i := 0; i < maxRetries; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("failed to send email after %d attempts: %w", i, ctx.Err())
+			case <-time.After(time.Second * time.Duration(i)):
+			}
+		}
+
+		err = c.sendMail(ctx, from.Address, msg.to, msg.raw)
+		if err == nil {
+			return nil
+		}
+
+		log.Printf("Failed to send email to %v, attempt %d of %d: %v", email, i+1, maxRetries, err)
+	}
+
+	return fmt.Errorf("failed to send email after %d attempts: %w", maxRetries, err)
+}
+
+// sendMail is smtp.SendMail with the connection bound to ctx.
+func (c *SMTPClient) sendMail(ctx context.Context, from, to string, raw []byte) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	client, err := smtp.NewClient(conn, c.host)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: c.host}); err != nil {
+			return err
+		}
+	}
+	if c.auth != nil {
+		if ok, _ := client.Extension("AUTH"); ok {
+			if err := client.Auth(c.auth); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(raw); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
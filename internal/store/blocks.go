@@ -0,0 +1,154 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrSelfBlock = errors.New("users cannot block or mute themselves")
+	ErrBlocked   = errors.New("interaction blocked between users")
+)
+
+type BlocksStore struct {
+	db *sql.DB
+}
+
+// Block makes blockerID block blockedID. Follows and pending follow requests
+// between both users are removed in either direction, together with the
+// follow counters they contributed to.
+func (s *BlocksStore) Block(ctx context.Context, blockerID int64, blockedID int64) error {
+	if blockerID == blockedID {
+		return ErrSelfBlock
+	}
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+		defer cancel()
+
+		_, err := tx.ExecContext(ctx, `INSERT INTO user_blocks (blocker_id, blocked_id) VALUES ($1, $2)`, blockerID, blockedID)
+		if err := relationInsertError(err); err != nil {
+			return err
+		}
+
+		for _, pair := range [][2]int64{{blockerID, blockedID}, {blockedID, blockerID}} {
+			followerID, userID := pair[0], pair[1]
+
+			res, err := tx.ExecContext(ctx, `DELETE FROM followers WHERE user_id = $1 AND follower_id = $2`, userID, followerID)
+			if err != nil {
+				return err
+			}
+			rows, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if rows > 0 {
+				if err := updateFollowCounters(ctx, tx, followerID, userID, -1); err != nil {
+					return err
+				}
+			}
+
+			if _, err := tx.ExecContext(ctx, `DELETE FROM follow_requests WHERE user_id = $1 AND requester_id = $2`, userID, followerID); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *BlocksStore) Unblock(ctx context.Context, blockerID int64, blockedID int64) error {
+	if blockerID == blockedID {
+		return ErrSelfBlock
+	}
+
+	return s.delete(ctx, `DELETE FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2`, blockerID, blockedID)
+}
+
+// Mute hides the posts and comments of mutedID from muterID without the
+// muted user noticing.
+func (s *BlocksStore) Mute(ctx context.Context, muterID int64, mutedID int64) error {
+	if muterID == mutedID {
+		return ErrSelfBlock
+	}
+
+	query := `INSERT INTO user_mutes (muter_id, muted_id) VALUES ($1, $2)`
+
+	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, muterID, mutedID)
+	return relationInsertError(err)
+}
+
+func (s *BlocksStore) Unmute(ctx context.Context, muterID int64, mutedID int64) error {
+	if muterID == mutedID {
+		return ErrSelfBlock
+	}
+
+	return s.delete(ctx, `DELETE FROM user_mutes WHERE muter_id = $1 AND muted_id = $2`, muterID, mutedID)
+}
+
+func (s *BlocksStore) delete(ctx context.Context, query string, args ...any) error {
+	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// notBlocked returns the SQL condition excluding content whose author blocked
+// the viewer or was blocked by them.
+func notBlocked(authorCol, viewer string) string {
+	return fmt.Sprintf(
+		"NOT EXISTS (SELECT 1 FROM user_blocks ub WHERE (ub.blocker_id = %[1]s AND ub.blocked_id = %[2]s) OR (ub.blocker_id = %[2]s AND ub.blocked_id = %[1]s))",
+		authorCol, viewer,
+	)
+}
+
+// notMuted returns the SQL condition excluding content of authors muted by the
+// viewer.
+func notMuted(authorCol, viewer string) string {
+	return fmt.Sprintf(
+		"NOT EXISTS (SELECT 1 FROM user_mutes um WHERE um.muter_id = %[2]s AND um.muted_id = %[1]s)",
+		authorCol, viewer,
+	)
+}
+
+// IsBlocked reports whether either user blocked the other.
+func (s *BlocksStore) IsBlocked(ctx context.Context, userID int64, otherID int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+	defer cancel()
+
+	var blocked bool
+	err := s.db.QueryRowContext(ctx, isBlockedQuery, userID, otherID).Scan(&blocked)
+	return blocked, err
+}
+
+const isBlockedQuery = `
+	SELECT EXISTS (
+		SELECT 1 FROM user_blocks
+		WHERE (blocker_id = $1 AND blocked_id = $2) OR (blocker_id = $2 AND blocked_id = $1)
+	)
+`
+
+// isBlocked is IsBlocked within tx.
+func isBlocked(ctx context.Context, tx *sql.Tx, userID int64, otherID int64) (bool, error) {
+	var blocked bool
+	err := tx.QueryRowContext(ctx, isBlockedQuery, userID, otherID).Scan(&blocked)
+	return blocked, err
+}
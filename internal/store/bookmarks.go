@@ -0,0 +1,254 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"strconv"
+	"time"
+)
+
+var ErrUnknownFolder = errors.New("bookmark folder not found")
+
+// Bookmark is a post saved privately by a user, optionally filed into one of
+// their folders.
+type Bookmark struct {
+	PostID    int64            `json:"post_id"`
+	FolderID  *int64           `json:"folder_id"`
+	CreatedAt time.Time        `json:"created_at"`
+	Post      PostWithMetadata `json:"post"`
+}
+
+type BookmarkFolder struct {
+	ID             int64     `json:"id"`
+	UserID         int64     `json:"user_id"`
+	Name           string    `json:"name"`
+	BookmarksCount int       `json:"bookmarks_count"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type BookmarksStore struct {
+	db *sql.DB
+}
+
+// Save bookmarks postID for userID, or moves an existing bookmark into
+// folderID. A nil folderID files the bookmark outside of any folder.
+// ErrUnknownFolder is returned when the folder does not belong to the user,
+// and ErrNotFound when the post no longer exists.
+func (s *BookmarksStore) Save(ctx context.Context, userID int64, postID int64, folderID *int64) (*Bookmark, error) {
+	bookmark := &Bookmark{PostID: postID, FolderID: folderID}
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+		defer cancel()
+
+		if folderID != nil {
+			var exists bool
+			err := tx.QueryRowContext(
+				ctx,
+				`SELECT EXISTS (SELECT 1 FROM bookmark_folders WHERE id = $1 AND user_id = $2)`,
+				*folderID,
+				userID,
+			).Scan(&exists)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				return ErrUnknownFolder
+			}
+		}
+
+		query := `
+			INSERT INTO bookmarks (user_id, post_id, folder_id) VALUES ($1, $2, $3)
+			ON CONFLICT (user_id, post_id) DO UPDATE SET folder_id = EXCLUDED.folder_id
+			RETURNING created_at
+		`
+
+		err := tx.QueryRowContext(ctx, query, userID, postID, folderID).Scan(&bookmark.CreatedAt)
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" && pqErr.Constraint == "bookmarks_folder_id_fkey" {
+			return ErrUnknownFolder
+		}
+		return relationInsertError(err)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return bookmark, nil
+}
+
+// Remove deletes the bookmark of userID on postID. Removing a missing
+// bookmark is a no-op.
+func (s *BookmarksStore) Remove(ctx context.Context, userID int64, postID int64) error {
+	query := `DELETE FROM bookmarks WHERE user_id = $1 AND post_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID, postID)
+	return err
+}
+
+// List returns the bookmarks of userID, most recent first by default,
+// restricted to folderID when it is set. Posts the user can no longer see,
+// because their author went private or a block is in place, are left out.
+func (s *BookmarksStore) List(ctx context.Context, userID int64, folderID *int64, q PaginatedQuery) ([]Bookmark, Pagination, error) {
+	args := []any{userID}
+	where := "b.user_id = $1 AND " + livePost + " AND (p.status = 'published' OR p.user_id = $1) AND " + visibleTo("p.user_id", "u.is_private", "$1") + " AND " + notBlocked("p.user_id", "$1")
+
+	if folderID != nil {
+		args = append(args, *folderID)
+		where += fmt.Sprintf(" AND b.folder_id = $%d", len(args))
+	}
+
+	if q.Cursor != nil {
+		args = append(args, q.Cursor.CreatedAt, q.Cursor.ID)
+		where += " AND " + keysetCondition("b.created_at", "b.post_id", q.Sort, len(args)-1)
+	}
+
+	args = append(args, q.Limit+1)
+
+	query := `
+		SELECT
+			b.post_id, b.folder_id, b.created_at,
+			p.id, p.user_id, p.title, p.content, p.created_at, p.updated_at, p.edited_at, p.version, p.tags, u.username, p.status,
+			(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id AND c.deleted_at IS NULL AND ` + notBlocked("c.user_id", "$1") + ` AND ` + notMuted("c.user_id", "$1") + `), ` + likesCount + `, ` + likedBy("COALESCE(p.repost_of_id, p.id)", "$1") + `,
+			` + referencedPostColumns("$1") + `
+		FROM bookmarks b
+		JOIN posts p ON p.id = b.post_id
+		JOIN users u ON u.id = p.user_id
+		` + referencedPostJoin + `
+		WHERE ` + where + `
+		ORDER BY b.created_at ` + q.Sort + `, b.post_id ` + q.Sort + `
+		LIMIT $` + strconv.Itoa(len(args)) + `
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Pagination{}, err
+	}
+	defer rows.Close()
+
+	bookmarks := []Bookmark{}
+	for rows.Next() {
+		var (
+			b   Bookmark
+			ref postRef
+		)
+		dest := []any{
+			&b.PostID,
+			&b.FolderID,
+			&b.CreatedAt,
+			&b.Post.ID,
+			&b.Post.UserID,
+			&b.Post.Title,
+			&b.Post.Content,
+			&b.Post.CreatedAt,
+			&b.Post.UpdatedAt,
+			&b.Post.EditedAt,
+			&b.Post.Version,
+			pq.Array(&b.Post.Tags),
+			&b.Post.User.Username,
+			&b.Post.Status,
+			&b.Post.CommentsCount,
+			&b.Post.LikesCount,
+			&b.Post.LikedByMe,
+		}
+		if err := rows.Scan(append(dest, ref.dest(&b.Post.Post)...)...); err != nil {
+			return nil, Pagination{}, err
+		}
+		ref.attach(&b.Post.Post)
+		b.Post.markEdited()
+		b.Post.User.ID = b.Post.UserID
+		b.Post.BookmarkedByMe = true
+		bookmarks = append(bookmarks, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, Pagination{}, err
+	}
+
+	bookmarks, pagination := newPagination(bookmarks, q.Limit, 0, true, func(b Bookmark) Cursor {
+		return Cursor{CreatedAt: b.CreatedAt, ID: b.PostID}
+	})
+	return bookmarks, pagination, nil
+}
+
+// CreateFolder returns ErrConflict when the user already has a folder with
+// the same name.
+func (s *BookmarksStore) CreateFolder(ctx context.Context, folder *BookmarkFolder) error {
+	query := `INSERT INTO bookmark_folders (user_id, name) VALUES ($1, $2) RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, folder.UserID, folder.Name).Scan(&folder.ID, &folder.CreatedAt)
+	return relationInsertError(err)
+}
+
+// GetFolders returns all folders of userID in alphabetical order.
+func (s *BookmarksStore) GetFolders(ctx context.Context, userID int64) ([]BookmarkFolder, error) {
+	query := `
+		SELECT f.id, f.user_id, f.name, COUNT(b.post_id), f.created_at
+		FROM bookmark_folders f
+		LEFT JOIN bookmarks b ON b.folder_id = f.id
+		WHERE f.user_id = $1
+		GROUP BY f.id
+		ORDER BY f.name ASC
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	folders := []BookmarkFolder{}
+	for rows.Next() {
+		var f BookmarkFolder
+		if err := rows.Scan(&f.ID, &f.UserID, &f.Name, &f.BookmarksCount, &f.CreatedAt); err != nil {
+			return nil, err
+		}
+		folders = append(folders, f)
+	}
+
+	return folders, rows.Err()
+}
+
+// DeleteFolder removes the folder of userID. The bookmarks it held are kept
+// and end up outside of any folder.
+func (s *BookmarksStore) DeleteFolder(ctx context.Context, userID int64, folderID int64) error {
+	query := `DELETE FROM bookmark_folders WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, folderID, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// bookmarkedBy returns the SQL expression telling whether viewer bookmarked
+// the post in postCol.
+func bookmarkedBy(postCol, viewer string) string {
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM bookmarks bm WHERE bm.post_id = %s AND bm.user_id = %s)", postCol, viewer)
+}
@@ -3,52 +3,147 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"strconv"
 	"time"
 )
 
+// MaxCommentDepth is the deepest level a reply can be nested at. Top level
+// comments have depth 0.
+const MaxCommentDepth = 5
+
 type Comment struct {
-	ID        int64        `json:"id"`
-	PostID    int64        `json:"post_id"`
-	UserID    int64        `json:"user_id"`
-	Content   string       `json:"content"`
-	CreatedAt time.Time    `json:"created_at"`
-	UpdatedAt sql.NullTime `json:"updated_at"`
-	User      User         `json:"user"`
+	ID         int64        `json:"id"`
+	PostID     int64        `json:"post_id"`
+	UserID     int64        `json:"user_id"`
+	ParentID   *int64       `json:"parent_id"`
+	Depth      int          `json:"depth"`
+	Content    string       `json:"content"`
+	Deleted    bool         `json:"deleted"`
+	ReplyCount int          `json:"reply_count"`
+	CreatedAt  time.Time    `json:"created_at"`
+	UpdatedAt  sql.NullTime `json:"updated_at"`
+	User       User         `json:"user"`
+	Replies    []Comment    `json:"replies,omitempty"`
 }
 
 type CommentsStore struct {
 	db *sql.DB
 }
 
+// Create inserts the comment. ErrNotFound is returned when the post it
+// belongs to does not exist and ErrBlocked when the commenter and the author
+// of the post (or of the comment replied to) blocked one another.
 func (s *CommentsStore) Create(ctx context.Context, comment *Comment) error {
-
-	query := "INSERT INTO comments (post_id, user_id, content) VALUES ($1, $2, $3) RETURNING id, created_at, updated_at;"
+	blockedQuery := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM posts p
+			LEFT JOIN comments pc ON pc.id = $3
+			JOIN user_blocks ub
+				ON (ub.blocker_id = $2 AND ub.blocked_id IN (p.user_id, pc.user_id))
+				OR (ub.blocked_id = $2 AND ub.blocker_id IN (p.user_id, pc.user_id))
+			WHERE p.id = $1
+		)
+	`
 
 	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
 	defer cancel()
 
-	err := s.db.QueryRowContext(ctx, query, comment.PostID, comment.UserID, comment.Content).Scan(&comment.ID, &comment.CreatedAt, &comment.UpdatedAt)
-	if err != nil {
+	var blocked bool
+	if err := s.db.QueryRowContext(ctx, blockedQuery, comment.PostID, comment.UserID, comment.ParentID).Scan(&blocked); err != nil {
 		return err
 	}
+	if blocked {
+		return ErrBlocked
+	}
+
+	query := `
+		INSERT INTO comments (post_id, user_id, content, parent_id, depth)
+		SELECT p.id, $2, $3, $4, COALESCE((SELECT depth + 1 FROM comments WHERE id = $4), 0)
+		FROM posts p
+		WHERE p.id = $1 AND p.deleted_at IS NULL AND (p.status = 'published' OR p.user_id = $2)
+		RETURNING id, depth, created_at, updated_at;
+	`
+
+	err := s.db.QueryRowContext(ctx, query, comment.PostID, comment.UserID, comment.Content, comment.ParentID).Scan(&comment.ID, &comment.Depth, &comment.CreatedAt, &comment.UpdatedAt)
+	if err != nil {
+		var pqErr *pq.Error
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNotFound
+		case errors.As(err, &pqErr) && pqErr.Code == "23503":
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
 
 	return nil
 
 }
 
-func (s *CommentsStore) GetByPostID(ctx context.Context, postID int64) ([]Comment, error) {
+// GetByID returns the comment as seen by viewerID (0 for anonymous viewers),
+// with its author hidden when it was deleted (see tombstone). Comments of
+// users who blocked the viewer or were blocked by them are reported as
+// ErrNotFound.
+func (s *CommentsStore) GetByID(ctx context.Context, id int64, viewerID int64) (*Comment, error) {
+	query := `
+		SELECT c.id, c.post_id, c.user_id, c.parent_id, c.depth, c.content, c.deleted_at IS NOT NULL, c.created_at, c.updated_at, users.username, users.id
+		FROM comments c
+		JOIN users ON c.user_id = users.id
+		WHERE c.id = $1 AND ` + notBlocked("c.user_id", "$2") + `
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+	defer cancel()
+
+	var c Comment
+	err := s.db.QueryRowContext(ctx, query, id, viewerID).Scan(
+		&c.ID,
+		&c.PostID,
+		&c.UserID,
+		&c.ParentID,
+		&c.Depth,
+		&c.Content,
+		&c.Deleted,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+		&c.User.Username,
+		&c.User.ID,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	c = tombstone(c)
+	return &c, nil
+}
+
+// GetByPostID returns the comments of a post as a tree: top level comments
+// newest first, each carrying its replies oldest first.
+//
+// Comments by authors the viewer blocked, was blocked by or muted are left
+// out together with their replies.
+func (s *CommentsStore) GetByPostID(ctx context.Context, postID int64, viewerID int64) ([]Comment, error) {
 	query := `
-		SELECT c.id, c.post_id, c.user_id, c.content, c.created_at,users.username, users.id
+		SELECT c.id, c.post_id, c.user_id, c.parent_id, c.depth, c.content, c.deleted_at IS NOT NULL, c.created_at, c.updated_at, users.username, users.id
 		FROM comments c
 		JOIN users ON c.user_id = users.id
-		WHERE c.post_id = $1
-		ORDER BY c.created_at DESC
+		WHERE c.post_id = $1 AND ` + notBlocked("c.user_id", "$2") + ` AND ` + notMuted("c.user_id", "$2") + `
+		ORDER BY c.created_at ASC, c.id ASC
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
 	defer cancel()
 
-	rows, err := s.db.QueryContext(ctx, query, postID)
+	rows, err := s.db.QueryContext(ctx, query, postID, viewerID)
 	if err != nil {
 		return nil, err
 	}
@@ -67,8 +162,12 @@ func (s *CommentsStore) GetByPostID(ctx context.Context, postID int64) ([]Commen
 			&c.ID,
 			&c.PostID,
 			&c.UserID,
+			&c.ParentID,
+			&c.Depth,
 			&c.Content,
+			&c.Deleted,
 			&c.CreatedAt,
+			&c.UpdatedAt,
 			&c.User.Username,
 			&c.User.ID,
 		)
@@ -76,8 +175,201 @@ func (s *CommentsStore) GetByPostID(ctx context.Context, postID int64) ([]Commen
 		if err != nil {
 			return nil, err
 		}
-		comments = append(comments, c)
+		comments = append(comments, tombstone(c))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return buildCommentTree(comments), nil
+}
+
+// ListByPostID returns a page of the top level comments of a post as seen by
+// viewerID. Replies are not included, only their count, which leaves out
+// replies hidden from the viewer.
+func (s *CommentsStore) ListByPostID(ctx context.Context, postID int64, viewerID int64, q PaginatedQuery) ([]Comment, Pagination, error) {
+	args := []any{postID, viewerID}
+	where := "c.post_id = $1 AND c.parent_id IS NULL AND " + notBlocked("c.user_id", "$2") + " AND " + notMuted("c.user_id", "$2")
+
+	if q.Cursor != nil {
+		args = append(args, q.Cursor.CreatedAt, q.Cursor.ID)
+		where += " AND " + keysetCondition("c.created_at", "c.id", q.Sort, len(args)-1)
+	}
+
+	args = append(args, q.Limit+1)
+
+	query := `
+		SELECT c.id, c.post_id, c.user_id, c.parent_id, c.depth, c.content, c.deleted_at IS NOT NULL, c.created_at, c.updated_at, users.username, users.id,
+			(SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.id AND r.deleted_at IS NULL AND ` + notBlocked("r.user_id", "$2") + ` AND ` + notMuted("r.user_id", "$2") + `) AS reply_count
+		FROM comments c
+		JOIN users ON c.user_id = users.id
+		WHERE ` + where + `
+		ORDER BY c.created_at ` + q.Sort + `, c.id ` + q.Sort + `
+		LIMIT $` + strconv.Itoa(len(args)) + `
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Pagination{}, err
+	}
+	defer rows.Close()
+
+	comments := []Comment{}
+	for rows.Next() {
+		var c Comment
+		err := rows.Scan(
+			&c.ID,
+			&c.PostID,
+			&c.UserID,
+			&c.ParentID,
+			&c.Depth,
+			&c.Content,
+			&c.Deleted,
+			&c.CreatedAt,
+			&c.UpdatedAt,
+			&c.User.Username,
+			&c.User.ID,
+			&c.ReplyCount,
+		)
+		if err != nil {
+			return nil, Pagination{}, err
+		}
+		comments = append(comments, tombstone(c))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, Pagination{}, err
+	}
+
+	comments, pagination := newPagination(comments, q.Limit, 0, true, func(c Comment) Cursor {
+		return Cursor{CreatedAt: c.CreatedAt, ID: c.ID}
+	})
+	return comments, pagination, nil
+}
+
+// Update saves the new content of a comment. Tombstoned comments cannot be
+// edited and are reported as ErrNotFound.
+func (s *CommentsStore) Update(ctx context.Context, comment *Comment) error {
+	query := `
+		UPDATE comments SET content = $1, updated_at = NOW()
+		WHERE id = $2 AND deleted_at IS NULL
+		RETURNING updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, comment.Content, comment.ID).Scan(&comment.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete removes a comment. Comments that still have replies are turned into
+// tombstones instead, so the thread below them stays reachable. Tombstones
+// left without replies by the deletion are removed as well.
+func (s *CommentsStore) Delete(ctx context.Context, id int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+		defer cancel()
+
+		tombstoneQuery := `
+			UPDATE comments SET content = '', deleted_at = NOW(), updated_at = NOW()
+			WHERE id = $1 AND EXISTS (SELECT 1 FROM comments WHERE parent_id = $1)
+		`
+		res, err := tx.ExecContext(ctx, tombstoneQuery, id)
+		if err != nil {
+			return err
+		}
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows > 0 {
+			return nil
+		}
+
+		var parentID sql.NullInt64
+		err = tx.QueryRowContext(ctx, "DELETE FROM comments WHERE id = $1 RETURNING parent_id", id).Scan(&parentID)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		// walk up the thread while the ancestors are tombstones whose last
+		// reply is gone
+		orphanQuery := `
+			DELETE FROM comments c
+			WHERE c.id = $1 AND c.deleted_at IS NOT NULL AND NOT EXISTS (SELECT 1 FROM comments r WHERE r.parent_id = c.id)
+			RETURNING c.parent_id
+		`
+		for parentID.Valid {
+			err := tx.QueryRowContext(ctx, orphanQuery, parentID.Int64).Scan(&parentID)
+			if errors.Is(err, sql.ErrNoRows) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// tombstone hides the author of a deleted comment.
+func tombstone(c Comment) Comment {
+	if c.Deleted {
+		c.Content = ""
+		c.UserID = 0
+		c.User = User{}
 	}
+	return c
+}
 
-	return comments, nil
+// buildCommentTree nests comments ordered oldest first under their parents
+// and fills in the reply counts, which leave out tombstones. The top level is
+// returned newest first.
+func buildCommentTree(comments []Comment) []Comment {
+	children := make(map[int64][]int)
+	var roots []int
+	for i, c := range comments {
+		if c.ParentID == nil {
+			roots = append(roots, i)
+			continue
+		}
+		children[*c.ParentID] = append(children[*c.ParentID], i)
+	}
+
+	var build func(i int) Comment
+	build = func(i int) Comment {
+		c := comments[i]
+		for _, child := range children[c.ID] {
+			reply := build(child)
+			if !reply.Deleted {
+				c.ReplyCount++
+			}
+			c.Replies = append(c.Replies, reply)
+		}
+		return c
+	}
+
+	tree := make([]Comment, 0, len(roots))
+	for i := len(roots) - 1; i >= 0; i-- {
+		tree = append(tree, build(roots[i]))
+	}
+	return tree
 }
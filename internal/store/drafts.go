@@ -0,0 +1,108 @@
+package store
+
+import (
+	"context"
+	"github.com/lib/pq"
+	"strconv"
+)
+
+// GetDrafts lists the draft and scheduled posts of userID, most recently
+// created first by default.
+func (s *PostsStore) GetDrafts(ctx context.Context, userID int64, q PaginatedQuery) ([]Post, Pagination, error) {
+	args := []any{userID}
+	where := "p.user_id = $1 AND p.status <> 'published' AND p.deleted_at IS NULL"
+
+	if q.Cursor != nil {
+		args = append(args, q.Cursor.CreatedAt, q.Cursor.ID)
+		where += " AND " + keysetCondition("p.created_at", "p.id", q.Sort, len(args)-1)
+	}
+
+	args = append(args, q.Limit+1)
+
+	query := `
+		SELECT p.id, p.user_id, p.title, p.content, p.version, p.tags, p.created_at, p.updated_at, p.status, p.publish_at, u.username
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		WHERE ` + where + `
+		ORDER BY p.created_at ` + q.Sort + `, p.id ` + q.Sort + `
+		LIMIT $` + strconv.Itoa(len(args)) + `
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Pagination{}, err
+	}
+	defer rows.Close()
+
+	drafts := []Post{}
+	for rows.Next() {
+		var post Post
+		err := rows.Scan(
+			&post.ID,
+			&post.UserID,
+			&post.Title,
+			&post.Content,
+			&post.Version,
+			pq.Array(&post.Tags),
+			&post.CreatedAt,
+			&post.UpdatedAt,
+			&post.Status,
+			&post.PublishAt,
+			&post.User.Username,
+		)
+		if err != nil {
+			return nil, Pagination{}, err
+		}
+		post.User.ID = post.UserID
+		drafts = append(drafts, post)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, Pagination{}, err
+	}
+
+	drafts, pagination := newPagination(drafts, q.Limit, 0, true, func(p Post) Cursor {
+		return Cursor{CreatedAt: p.CreatedAt, ID: p.ID}
+	})
+	return drafts, pagination, nil
+}
+
+// PublishDue publishes up to limit scheduled posts whose publish time has
+// passed and returns how many it published. Like any published post they lose
+// their publish time. Publishing bumps the version like any other update, so
+// stale edits are rejected, and keeps the scheduled version in post_revisions.
+// Due rows are locked with SKIP LOCKED, so several API instances can run the
+// scheduler without publishing a post twice; posts missed while no instance
+// was running are picked up on the next call.
+func (s *PostsStore) PublishDue(ctx context.Context, limit int) (int64, error) {
+	query := `
+		WITH due AS (
+			SELECT id FROM posts
+			WHERE status = 'scheduled' AND publish_at <= NOW() AND deleted_at IS NULL
+			ORDER BY publish_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		), revisions AS (
+			INSERT INTO post_revisions (post_id, version, title, content, created_at, status)
+			SELECT p.id, p.version, p.title, p.content, ` + versionCreatedAt + `, p.status
+			FROM posts p
+			JOIN due ON due.id = p.id
+		)
+		UPDATE posts p
+		SET status = 'published', publish_at = NULL, created_at = NOW(), updated_at = NOW(), version = version + 1
+		FROM due
+		WHERE p.id = due.id;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
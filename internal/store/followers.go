@@ -4,40 +4,321 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"fmt"
 	"github.com/lib/pq"
+	"strconv"
+	"time"
 )
 
+var ErrSelfFollow = errors.New("users cannot follow themselves")
+
 type Follower struct {
 	UserID     int64  `json:"user_id"`
 	FollowerID int64  `json:"follower_id"`
 	CreatedAt  string `json:"created_at"`
 }
 
+// FollowUser is an entry of a followers or following list.
+type FollowUser struct {
+	ID         int64     `json:"id"`
+	Username   string    `json:"username"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+// FollowRequest is a pending request to follow a private account.
+type FollowRequest struct {
+	ID          int64     `json:"id"`
+	Username    string    `json:"username"`
+	RequestedAt time.Time `json:"requested_at"`
+}
+
 type FollowersStore struct {
 	db *sql.DB
 }
 
-func (s *FollowersStore) Follow(ctx context.Context, followerID int64, userID int64) error {
+type FollowState string
+
+const (
+	FollowStateFollowing FollowState = "following"
+	FollowStateRequested FollowState = "requested"
+)
+
+// Follow makes followerID follow userID and bumps the follow counters of both
+// users in the same transaction. When userID is a private account a follow
+// request is created instead and FollowStateRequested is returned.
+//
+// It returns ErrSelfFollow when both are the same user, ErrNotFound when
+// either user does not exist, ErrBlocked when either user blocked the other
+// and ErrConflict when the follow (or follow request) already exists.
+func (s *FollowersStore) Follow(ctx context.Context, followerID int64, userID int64) (FollowState, error) {
+	if followerID == userID {
+		return "", ErrSelfFollow
+	}
+
+	var state FollowState
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+		defer cancel()
+
+		var isPrivate, following bool
+		err := tx.QueryRowContext(ctx, `
+			SELECT u.is_private, EXISTS (SELECT 1 FROM followers f WHERE f.user_id = u.id AND f.follower_id = $2)
+			FROM users u
+			WHERE u.id = $1
+			FOR SHARE OF u
+		`, userID, followerID).Scan(&isPrivate, &following)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		if following {
+			return ErrConflict
+		}
+
+		blocked, err := isBlocked(ctx, tx, followerID, userID)
+		if err != nil {
+			return err
+		}
+		if blocked {
+			return ErrBlocked
+		}
+
+		if isPrivate {
+			state = FollowStateRequested
+			_, err := tx.ExecContext(ctx, `INSERT INTO follow_requests(user_id, requester_id) VALUES ($1, $2)`, userID, followerID)
+			return relationInsertError(err)
+		}
+
+		state = FollowStateFollowing
+		return follow(ctx, tx, followerID, userID)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return state, nil
+}
+
+func follow(ctx context.Context, tx *sql.Tx, followerID int64, userID int64) error {
 	query := `INSERT INTO followers(user_id, follower_id) VALUES ($1, $2)`
+
+	_, err := tx.ExecContext(ctx, query, userID, followerID)
+	if err := relationInsertError(err); err != nil {
+		return err
+	}
+
+	return updateFollowCounters(ctx, tx, followerID, userID, 1)
+}
+
+func relationInsertError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var pqErr *pq.Error
+	switch {
+	case errors.As(err, &pqErr) && pqErr.Code == "23505":
+		return ErrConflict
+	case errors.As(err, &pqErr) && pqErr.Code == "23503":
+		return ErrNotFound
+	}
+	return err
+}
+
+// Unfollow removes the follow and decrements the counters, or withdraws a
+// pending follow request. ErrNotFound is returned when followerID was neither
+// following nor requesting to follow userID, so callers can tell a no-op
+// apart from an actual unfollow.
+func (s *FollowersStore) Unfollow(ctx context.Context, followerID int64, userID int64) error {
+	if followerID == userID {
+		return ErrSelfFollow
+	}
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `DELETE FROM followers WHERE user_id = $1 AND follower_id = $2`
+		ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+		defer cancel()
+
+		res, err := tx.ExecContext(ctx, query, userID, followerID)
+		if err != nil {
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return deleteFollowRequest(ctx, tx, userID, followerID)
+		}
+
+		return updateFollowCounters(ctx, tx, followerID, userID, -1)
+	})
+}
+
+// ApproveFollowRequest turns the pending request of requesterID into a follow
+// of userID.
+func (s *FollowersStore) ApproveFollowRequest(ctx context.Context, userID int64, requesterID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+		defer cancel()
+
+		if err := deleteFollowRequest(ctx, tx, userID, requesterID); err != nil {
+			return err
+		}
+
+		return follow(ctx, tx, requesterID, userID)
+	})
+}
+
+func (s *FollowersStore) RejectFollowRequest(ctx context.Context, userID int64, requesterID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+		defer cancel()
+
+		return deleteFollowRequest(ctx, tx, userID, requesterID)
+	})
+}
+
+func deleteFollowRequest(ctx context.Context, tx *sql.Tx, userID int64, requesterID int64) error {
+	res, err := tx.ExecContext(ctx, `DELETE FROM follow_requests WHERE user_id = $1 AND requester_id = $2`, userID, requesterID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetFollowRequests lists the users waiting for userID to approve their
+// follow request, most recent first.
+func (s *FollowersStore) GetFollowRequests(ctx context.Context, userID int64, q PaginatedQuery) ([]FollowRequest, Pagination, error) {
+	args := []any{userID}
+	where := "fr.user_id = $1"
+
+	if q.Cursor != nil {
+		args = append(args, q.Cursor.CreatedAt, q.Cursor.ID)
+		where += " AND " + keysetCondition("fr.created_at", "fr.requester_id", q.Sort, len(args)-1)
+	}
+
+	args = append(args, q.Limit+1)
+
+	query := `
+		SELECT u.id, u.username, fr.created_at
+		FROM follow_requests fr
+		JOIN users u ON u.id = fr.requester_id
+		WHERE ` + where + `
+		ORDER BY fr.created_at ` + q.Sort + `, fr.requester_id ` + q.Sort + `
+		LIMIT $` + strconv.Itoa(len(args)) + `
+	`
+
 	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
 	defer cancel()
 
-	_, err := s.db.ExecContext(ctx, query, userID, followerID)
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		var pqErr *pq.Error
-		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
-			return fmt.Errorf("duplicate key value violates unique constraint %s", err)
+		return nil, Pagination{}, err
+	}
+	defer rows.Close()
+
+	requests := []FollowRequest{}
+	for rows.Next() {
+		var fr FollowRequest
+		if err := rows.Scan(&fr.ID, &fr.Username, &fr.RequestedAt); err != nil {
+			return nil, Pagination{}, err
 		}
+		requests = append(requests, fr)
 	}
-	return nil
+	if err := rows.Err(); err != nil {
+		return nil, Pagination{}, err
+	}
+
+	requests, pagination := newPagination(requests, q.Limit, 0, true, func(fr FollowRequest) Cursor {
+		return Cursor{CreatedAt: fr.RequestedAt, ID: fr.ID}
+	})
+	return requests, pagination, nil
 }
 
-func (s *FollowersStore) Unfollow(ctx context.Context, followerID int64, userID int64) error {
-	query := `DELETE FROM followers WHERE user_id = $1 AND follower_id = $2`
+func updateFollowCounters(ctx context.Context, tx *sql.Tx, followerID int64, userID int64, delta int) error {
+	if _, err := tx.ExecContext(ctx, `UPDATE users SET followers_count = followers_count + $1 WHERE id = $2`, delta, userID); err != nil {
+		return err
+	}
+
+	_, err := tx.ExecContext(ctx, `UPDATE users SET following_count = following_count + $1 WHERE id = $2`, delta, followerID)
+	return err
+}
+
+// GetFollowers lists the users following userID, most recent follow first.
+// Users that blocked viewerID or were blocked by them are left out, and the
+// list of a private account is empty unless viewerID is the user or follows
+// them.
+func (s *FollowersStore) GetFollowers(ctx context.Context, userID int64, viewerID int64, q PaginatedQuery) ([]FollowUser, Pagination, error) {
+	return s.list(ctx, "f.user_id", "f.follower_id", userID, viewerID, q)
+}
+
+// GetFollowing lists the users userID follows, most recent follow first.
+// Users that blocked viewerID or were blocked by them are left out, and the
+// list of a private account is empty unless viewerID is the user or follows
+// them.
+func (s *FollowersStore) GetFollowing(ctx context.Context, userID int64, viewerID int64, q PaginatedQuery) ([]FollowUser, Pagination, error) {
+	return s.list(ctx, "f.follower_id", "f.user_id", userID, viewerID, q)
+}
+
+func (s *FollowersStore) list(ctx context.Context, matchCol, userCol string, userID int64, viewerID int64, q PaginatedQuery) ([]FollowUser, Pagination, error) {
+	args := []any{userID, viewerID}
+	where := matchCol + " = $1 AND " + notBlocked("u.id", "$2") +
+		" AND EXISTS (SELECT 1 FROM users o WHERE o.id = $1 AND " + visibleTo("o.id", "o.is_private", "$2") + ")"
+
+	if q.Cursor != nil {
+		args = append(args, q.Cursor.CreatedAt, q.Cursor.ID)
+		where += " AND " + keysetCondition("f.created_at", userCol, q.Sort, len(args)-1)
+	}
+
+	args = append(args, q.Limit+1)
+
+	query := `
+		SELECT u.id, u.username, f.created_at
+		FROM followers f
+		JOIN users u ON u.id = ` + userCol + `
+		WHERE ` + where + `
+		ORDER BY f.created_at ` + q.Sort + `, ` + userCol + ` ` + q.Sort + `
+		LIMIT $` + strconv.Itoa(len(args)) + `
+	`
+
 	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
 	defer cancel()
-	_, err := s.db.ExecContext(ctx, query, userID, followerID)
-	return err
 
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Pagination{}, err
+	}
+	defer rows.Close()
+
+	users := []FollowUser{}
+	for rows.Next() {
+		var u FollowUser
+		if err := rows.Scan(&u.ID, &u.Username, &u.FollowedAt); err != nil {
+			return nil, Pagination{}, err
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, Pagination{}, err
+	}
+
+	users, pagination := newPagination(users, q.Limit, 0, true, func(u FollowUser) Cursor {
+		return Cursor{CreatedAt: u.FollowedAt, ID: u.ID}
+	})
+	return users, pagination, nil
 }
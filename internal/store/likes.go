@@ -0,0 +1,83 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// LikeState is the like status of a post after a like or unlike.
+type LikeState struct {
+	LikesCount int  `json:"likes_count"`
+	LikedByMe  bool `json:"liked_by_me"`
+}
+
+type LikesStore struct {
+	db *sql.DB
+}
+
+// Like records that userID likes postID. Liking a post twice is a no-op, so
+// the request can safely be retried. Likes of a repost go to the original.
+func (s *LikesStore) Like(ctx context.Context, postID int64, userID int64) (LikeState, error) {
+	return s.update(ctx, `INSERT INTO post_likes (post_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`, postID, userID, 1)
+}
+
+// Unlike removes the like of userID from postID, if there was one.
+func (s *LikesStore) Unlike(ctx context.Context, postID int64, userID int64) (LikeState, error) {
+	return s.update(ctx, `DELETE FROM post_likes WHERE post_id = $1 AND user_id = $2`, postID, userID, -1)
+}
+
+// update runs query and adjusts the likes counter of the post by delta when
+// it changed a row. A repost is resolved to the post it shares first.
+func (s *LikesStore) update(ctx context.Context, query string, postID int64, userID int64, delta int) (LikeState, error) {
+	state := LikeState{LikedByMe: delta > 0}
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+		defer cancel()
+
+		err := tx.QueryRowContext(ctx, `SELECT COALESCE(repost_of_id, id) FROM posts WHERE id = $1`, postID).Scan(&postID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		res, err := tx.ExecContext(ctx, query, postID, userID)
+		if err := relationInsertError(err); err != nil {
+			return err
+		}
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			delta = 0
+		}
+
+		err = tx.QueryRowContext(
+			ctx,
+			`UPDATE posts SET likes_count = likes_count + $2 WHERE id = $1 RETURNING likes_count`,
+			postID,
+			delta,
+		).Scan(&state.LikesCount)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return err
+	})
+
+	return state, err
+}
+
+// likesCount is the likes counter of post p, taken from the original for
+// reposts. It expects the reposted post as rp, see referencedPostJoin.
+const likesCount = "CASE WHEN p.repost_of_id IS NOT NULL THEN rp.likes_count ELSE p.likes_count END"
+
+// likedBy returns the SQL expression telling whether viewer liked the post in
+// postCol.
+func likedBy(postCol, viewer string) string {
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM post_likes pl WHERE pl.post_id = %s AND pl.user_id = %s)", postCol, viewer)
+}
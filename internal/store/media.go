@@ -0,0 +1,258 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	MediaStatusPending    = "pending"
+	MediaStatusProcessing = "processing"
+	MediaStatusReady      = "ready"
+	MediaStatusFailed     = "failed"
+)
+
+const (
+	// mediaMaxAttempts bounds how often a media item is retried after
+	// transient failures or a worker dying mid-way.
+	mediaMaxAttempts = 3
+	// mediaProcessingTimeout is how long a claimed item may stay in
+	// processing before another worker reclaims it.
+	mediaProcessingTimeout = 5 * time.Minute
+	// mediaRetryDelay is how long a failed item waits before it is claimed
+	// again, multiplied by the attempts made so far.
+	mediaRetryDelay = time.Minute
+)
+
+type Media struct {
+	ID           int64     `json:"id"`
+	UserID       int64     `json:"user_id"`
+	Key          string    `json:"-"`
+	ThumbnailKey string    `json:"-"`
+	URL          string    `json:"url,omitempty"`
+	ThumbnailURL string    `json:"thumbnail_url,omitempty"`
+	ContentType  string    `json:"content_type"`
+	Size         int64     `json:"size"`
+	Status       string    `json:"status"`
+	Width        int       `json:"width,omitempty"`
+	Height       int       `json:"height,omitempty"`
+	Blurhash     string    `json:"blurhash,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	// Attempts identifies the claim a worker is processing the item under.
+	Attempts int `json:"-"`
+}
+
+// IsReady reports whether processing finished and the media may be served.
+func (m *Media) IsReady() bool {
+	return m.Status == MediaStatusReady
+}
+
+type MediaStore struct {
+	db *sql.DB
+}
+
+const mediaColumns = `
+	m.id, m.user_id, m.storage_key, COALESCE(m.thumbnail_key, ''), m.content_type, m.size_bytes,
+	m.status, COALESCE(m.width, 0), COALESCE(m.height, 0), COALESCE(m.blurhash, ''), m.created_at, m.attempts
+`
+
+func scanMedia(row interface{ Scan(...any) error }, m *Media) error {
+	return row.Scan(
+		&m.ID,
+		&m.UserID,
+		&m.Key,
+		&m.ThumbnailKey,
+		&m.ContentType,
+		&m.Size,
+		&m.Status,
+		&m.Width,
+		&m.Height,
+		&m.Blurhash,
+		&m.CreatedAt,
+		&m.Attempts,
+	)
+}
+
+func (s *MediaStore) Create(ctx context.Context, media *Media) error {
+	query := `
+		INSERT INTO media (user_id, storage_key, content_type, size_bytes)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, status, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+	defer cancel()
+
+	return s.db.QueryRowContext(ctx, query, media.UserID, media.Key, media.ContentType, media.Size).Scan(&media.ID, &media.Status, &media.CreatedAt)
+}
+
+func (s *MediaStore) GetByID(ctx context.Context, id int64) (*Media, error) {
+	query := `SELECT ` + mediaColumns + ` FROM media m WHERE m.id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+	defer cancel()
+
+	var m Media
+	err := scanMedia(s.db.QueryRowContext(ctx, query, id), &m)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &m, nil
+}
+
+// GetByPostID returns the media attached to a post in the order they were
+// referenced when the post was created.
+func (s *MediaStore) GetByPostID(ctx context.Context, postID int64) ([]Media, error) {
+	query := `
+		SELECT ` + mediaColumns + `
+		FROM post_media pm
+		JOIN media m ON m.id = pm.media_id
+		WHERE pm.post_id = $1
+		ORDER BY pm.position ASC
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	media := []Media{}
+	for rows.Next() {
+		var m Media
+		if err := scanMedia(rows, &m); err != nil {
+			return nil, err
+		}
+		media = append(media, m)
+	}
+
+	return media, rows.Err()
+}
+
+// ClaimPending moves up to limit pending media to processing and returns them.
+// Rows locked by another worker are skipped, so several API instances can
+// process media concurrently. Items waiting for a retry are left alone until
+// their next attempt is due. Items stuck in processing for longer than
+// mediaProcessingTimeout are reclaimed, or failed once out of attempts.
+func (s *MediaStore) ClaimPending(ctx context.Context, limit int) ([]Media, error) {
+	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+	defer cancel()
+
+	media := []Media{}
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		expired := `
+			UPDATE media
+			SET status = 'failed', error = 'processing timed out', processing_started_at = NULL
+			WHERE status = 'processing'
+				AND attempts >= $1
+				AND processing_started_at < NOW() - make_interval(secs => $2)
+		`
+		if _, err := tx.ExecContext(ctx, expired, mediaMaxAttempts, mediaProcessingTimeout.Seconds()); err != nil {
+			return err
+		}
+
+		query := `
+			UPDATE media m
+			SET status = 'processing', attempts = m.attempts + 1, processing_started_at = NOW()
+			WHERE m.id IN (
+				SELECT id FROM media
+				WHERE attempts < $2
+					AND (
+						(status = 'pending' AND (next_attempt_at IS NULL OR next_attempt_at <= NOW()))
+						OR (status = 'processing' AND processing_started_at < NOW() - make_interval(secs => $3))
+					)
+				ORDER BY id
+				LIMIT $1
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING ` + mediaColumns
+
+		rows, err := tx.QueryContext(ctx, query, limit, mediaMaxAttempts, mediaProcessingTimeout.Seconds())
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var m Media
+			if err := scanMedia(rows, &m); err != nil {
+				return err
+			}
+			media = append(media, m)
+		}
+
+		return rows.Err()
+	})
+
+	return media, err
+}
+
+// MarkReady stores the processing results. It returns ErrNotFound when the
+// claim the item was processed under is gone, because it timed out and the
+// item was reclaimed or failed meanwhile.
+func (s *MediaStore) MarkReady(ctx context.Context, media *Media) error {
+	query := `
+		UPDATE media
+		SET storage_key = $2, thumbnail_key = $3, size_bytes = $4, width = $5, height = $6, blurhash = $7,
+			status = 'ready', error = NULL, processing_started_at = NULL
+		WHERE id = $1 AND status = 'processing' AND attempts = $8
+		RETURNING status
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+	defer cancel()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		media.ID,
+		media.Key,
+		media.ThumbnailKey,
+		media.Size,
+		media.Width,
+		media.Height,
+		media.Blurhash,
+		media.Attempts,
+	).Scan(&media.Status)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MarkFailed records a processing error. When retry is set and attempts are
+// left the item goes back to pending, to be claimed again after a delay
+// growing with every attempt. Otherwise it is failed for good. Items
+// reclaimed since they were claimed as media are left alone.
+func (s *MediaStore) MarkFailed(ctx context.Context, media *Media, reason string, retry bool) error {
+	query := `
+		UPDATE media
+		SET status = CASE WHEN $3 AND attempts < $4 THEN 'pending' ELSE 'failed' END,
+			next_attempt_at = NOW() + make_interval(secs => $5) * attempts,
+			error = $2, processing_started_at = NULL
+		WHERE id = $1 AND status = 'processing' AND attempts = $6
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, media.ID, reason, retry, mediaMaxAttempts, mediaRetryDelay.Seconds(), media.Attempts)
+	return err
+}
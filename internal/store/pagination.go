@@ -1,15 +1,130 @@
 package store
 
 import (
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 )
 
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor points at the last row of a page ordered by (created_at, id). It is
+// handed to clients as an opaque token, see EncodeCursor.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        int64
+}
+
+func EncodeCursor(c Cursor) string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "," + strconv.FormatInt(c.ID, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeCursor(s string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	createdAt, id, ok := strings.Cut(string(raw), ",")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &Cursor{CreatedAt: t, ID: i}, nil
+}
+
+// Pagination describes the page returned alongside a list. NextCursor is only
+// set for keyset (cursor) pagination and is empty on the last page.
+type Pagination struct {
+	Limit      int    `json:"limit"`
+	Offset     int    `json:"offset,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+}
+
+// newPagination trims the extra row fetched to detect further pages and
+// builds the Pagination for it. rows must have been queried with limit+1.
+func newPagination[T any](rows []T, limit, offset int, keyset bool, cursorOf func(T) Cursor) ([]T, Pagination) {
+	p := Pagination{Limit: limit, Offset: offset}
+	if len(rows) > limit {
+		rows = rows[:limit]
+		p.HasMore = true
+		if keyset {
+			p.NextCursor = EncodeCursor(cursorOf(rows[len(rows)-1]))
+		}
+	}
+	return rows, p
+}
+
+// keysetCondition returns the SQL condition selecting rows after cursor for
+// the given sort direction, using $n and $n+1 as placeholders.
+func keysetCondition(createdAtCol, idCol, sort string, n int) string {
+	op := "<"
+	if sort == "asc" {
+		op = ">"
+	}
+	return fmt.Sprintf("(%s, %s) %s ($%d, $%d)", createdAtCol, idCol, op, n, n+1)
+}
+
+// PaginatedQuery is the plain limit/cursor pagination used by lists that do
+// not support the feed filters, such as comments.
+type PaginatedQuery struct {
+	Limit  int     `json:"limit" validate:"gte=1,lte=50"`
+	Sort   string  `json:"sort" validate:"oneof=desc asc"`
+	Cursor *Cursor `json:"-"`
+}
+
+func (q PaginatedQuery) Parse(r *http.Request) (PaginatedQuery, error) {
+	qs := r.URL.Query()
+
+	limit := qs.Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return q, fmt.Errorf("invalid limit %q", limit)
+		}
+		q.Limit = l
+	}
+
+	sort := qs.Get("sort")
+	if sort != "" {
+		q.Sort = sort
+	}
+
+	cursor := qs.Get("cursor")
+	if cursor != "" {
+		c, err := DecodeCursor(cursor)
+		if err != nil {
+			return q, err
+		}
+		q.Cursor = c
+	}
+
+	return q, nil
+}
+
+// PaginatedFeedQuery supports both offset and cursor pagination. Offset
+// pagination is kept for existing clients; pages requested without an offset
+// carry a cursor for the next one.
 type PaginatedFeedQuery struct {
 	Limit  int      `json:"limit" validate:"gte=1,lte=20"`
 	Offset int      `json:"offset" validate:"gte=0"`
+	Cursor *Cursor  `json:"-"`
 	Sort   string   `json:"sort" validate:"oneof=desc asc"`
 	Tags   []string `json:"tags" validate:"max=5"`
 	Search string   `json:"search" validate:"max=100"`
@@ -24,7 +139,7 @@ func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error)
 	if limit != "" {
 		l, err := strconv.Atoi(qs.Get("limit"))
 		if err != nil {
-			return fq, nil
+			return fq, fmt.Errorf("invalid limit %q", limit)
 		}
 		fq.Limit = l
 	}
@@ -33,11 +148,23 @@ func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error)
 	if offset != "" {
 		l, err := strconv.Atoi(qs.Get("offset"))
 		if err != nil {
-			return fq, nil
+			return fq, fmt.Errorf("invalid offset %q", offset)
 		}
 		fq.Offset = l
 	}
 
+	cursor := qs.Get("cursor")
+	if cursor != "" {
+		if offset != "" {
+			return fq, errors.New("offset and cursor cannot be combined")
+		}
+		c, err := DecodeCursor(cursor)
+		if err != nil {
+			return fq, err
+		}
+		fq.Cursor = c
+	}
+
 	sort := qs.Get("sort")
 	if sort != "" {
 		fq.Sort = sort
@@ -55,23 +182,41 @@ func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error)
 
 	since := qs.Get("since")
 	if since != "" {
-		fq.Since = parseTime(since)
+		t, err := parseTime(since)
+		if err != nil {
+			return fq, fmt.Errorf("invalid since %q: %w", since, err)
+		}
+		fq.Since = t
 	}
 
 	until := qs.Get("until")
 	if until != "" {
-		fq.Since = parseTime(until)
+		t, err := parseTime(until)
+		if err != nil {
+			return fq, fmt.Errorf("invalid until %q: %w", until, err)
+		}
+		fq.Until = t
+	}
+
+	if fq.Since != "" && fq.Until != "" && fq.Until < fq.Since {
+		return fq, fmt.Errorf("until %q is before since %q", until, since)
 	}
 
 	return fq, nil
 
 }
 
-func parseTime(s string) string {
-	t, err := time.Parse(time.DateTime, s)
+// parseTime accepts RFC 3339 timestamps as well as the "2006-01-02 15:04:05"
+// layout (interpreted as UTC) and normalises them to RFC 3339 in UTC, so the
+// result can be compared as a string and passed straight to Postgres.
+func parseTime(s string) (string, error) {
+	t, err := time.Parse(time.RFC3339, s)
 	if err != nil {
-		return ""
+		t, err = time.Parse(time.DateTime, s)
+		if err != nil {
+			return "", fmt.Errorf("expected RFC 3339 or %q layout", time.DateTime)
+		}
 	}
 
-	return t.Format(time.DateTime)
+	return t.UTC().Format(time.RFC3339), nil
 }
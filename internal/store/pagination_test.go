@@ -0,0 +1,264 @@
+package store
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor Cursor
+	}{
+		{"utc", Cursor{CreatedAt: time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC), ID: 42}},
+		{"sub-second", Cursor{CreatedAt: time.Date(2024, 5, 1, 12, 30, 0, 123456789, time.UTC), ID: 1}},
+		{"other zone", Cursor{CreatedAt: time.Date(2024, 5, 1, 19, 30, 0, 0, time.FixedZone("WIB", 7*3600)), ID: 7}},
+		{"zero id", Cursor{CreatedAt: time.Unix(0, 0), ID: 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeCursor(EncodeCursor(tt.cursor))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !got.CreatedAt.Equal(tt.cursor.CreatedAt) || got.ID != tt.cursor.ID {
+				t.Errorf("got %+v, want %+v", *got, tt.cursor)
+			}
+		})
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	encode := func(raw string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(raw))
+	}
+
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"not base64", "!!!"},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte("2024-05-01T12:30:00Z,1"))},
+		{"no separator", encode("2024-05-01T12:30:00Z")},
+		{"bad time", encode("yesterday,1")},
+		{"bad id", encode("2024-05-01T12:30:00Z,one")},
+		{"empty id", encode("2024-05-01T12:30:00Z,")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeCursor(tt.input); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("got error %v, want ErrInvalidCursor", err)
+			}
+		})
+	}
+}
+
+func TestNewPagination(t *testing.T) {
+	base := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	cursorOf := func(id int) Cursor {
+		return Cursor{CreatedAt: base.Add(time.Duration(id) * time.Minute), ID: int64(id)}
+	}
+
+	tests := []struct {
+		name     string
+		rows     []int
+		limit    int
+		offset   int
+		keyset   bool
+		wantRows []int
+		want     Pagination
+	}{
+		{
+			name:     "last page",
+			rows:     []int{1, 2},
+			limit:    2,
+			keyset:   true,
+			wantRows: []int{1, 2},
+			want:     Pagination{Limit: 2},
+		},
+		{
+			name:     "more with keyset",
+			rows:     []int{1, 2, 3},
+			limit:    2,
+			keyset:   true,
+			wantRows: []int{1, 2},
+			want:     Pagination{Limit: 2, HasMore: true, NextCursor: EncodeCursor(cursorOf(2))},
+		},
+		{
+			name:     "more with offset",
+			rows:     []int{1, 2, 3},
+			limit:    2,
+			offset:   4,
+			wantRows: []int{1, 2},
+			want:     Pagination{Limit: 2, Offset: 4, HasMore: true},
+		},
+		{
+			name:     "empty",
+			rows:     []int{},
+			limit:    20,
+			keyset:   true,
+			wantRows: []int{},
+			want:     Pagination{Limit: 20},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, p := newPagination(tt.rows, tt.limit, tt.offset, tt.keyset, cursorOf)
+			if !reflect.DeepEqual(rows, tt.wantRows) {
+				t.Errorf("rows = %v, want %v", rows, tt.wantRows)
+			}
+			if p != tt.want {
+				t.Errorf("pagination = %+v, want %+v", p, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeysetCondition(t *testing.T) {
+	tests := []struct {
+		sort string
+		n    int
+		want string
+	}{
+		{"desc", 2, "(p.created_at, p.id) < ($2, $3)"},
+		{"asc", 4, "(p.created_at, p.id) > ($4, $5)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			if got := keysetCondition("p.created_at", "p.id", tt.sort, tt.n); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaginatedQueryParse(t *testing.T) {
+	cursor := Cursor{CreatedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), ID: 9}
+
+	tests := []struct {
+		name    string
+		query   string
+		want    PaginatedQuery
+		wantErr bool
+	}{
+		{
+			name:  "defaults",
+			query: "",
+			want:  PaginatedQuery{Limit: 20, Sort: "desc"},
+		},
+		{
+			name:  "all set",
+			query: "limit=5&sort=asc&cursor=" + EncodeCursor(cursor),
+			want:  PaginatedQuery{Limit: 5, Sort: "asc", Cursor: &cursor},
+		},
+		{
+			name:    "bad limit",
+			query:   "limit=ten",
+			wantErr: true,
+		},
+		{
+			name:    "bad cursor",
+			query:   "cursor=nope",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/?"+tt.query, nil)
+			got, err := PaginatedQuery{Limit: 20, Sort: "desc"}.Parse(r)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaginatedFeedQueryParse(t *testing.T) {
+	cursor := Cursor{CreatedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), ID: 9}
+	defaults := PaginatedFeedQuery{Limit: 20, Sort: "desc"}
+
+	tests := []struct {
+		name    string
+		query   string
+		want    PaginatedFeedQuery
+		wantErr bool
+	}{
+		{
+			name:  "defaults",
+			query: "",
+			want:  defaults,
+		},
+		{
+			name:  "offset",
+			query: "limit=10&offset=30&tags=go,sql&search=chi",
+			want:  PaginatedFeedQuery{Limit: 10, Offset: 30, Sort: "desc", Tags: []string{"go", "sql"}, Search: "chi"},
+		},
+		{
+			name:  "cursor",
+			query: "cursor=" + EncodeCursor(cursor) + "&sort=asc",
+			want:  PaginatedFeedQuery{Limit: 20, Sort: "asc", Cursor: &cursor},
+		},
+		{
+			name:  "time range normalised to utc",
+			query: "since=2024-05-01+07:00:00&until=2024-05-02T00:00:00%2B07:00",
+			want:  PaginatedFeedQuery{Limit: 20, Sort: "desc", Since: "2024-05-01T07:00:00Z", Until: "2024-05-01T17:00:00Z"},
+		},
+		{
+			name:    "offset with cursor",
+			query:   "offset=20&cursor=" + EncodeCursor(cursor),
+			wantErr: true,
+		},
+		{
+			name:    "bad offset",
+			query:   "offset=-x",
+			wantErr: true,
+		},
+		{
+			name:    "bad since",
+			query:   "since=last+week",
+			wantErr: true,
+		},
+		{
+			name:    "until before since",
+			query:   "since=2024-05-02T00:00:00Z&until=2024-05-01T00:00:00Z",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/?"+tt.query, nil)
+			got, err := defaults.Parse(r)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
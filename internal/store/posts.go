@@ -4,10 +4,19 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"github.com/lib/pq"
+	"strconv"
+	"strings"
 	"time"
 )
 
+const (
+	PostStatusDraft     = "draft"
+	PostStatusScheduled = "scheduled"
+	PostStatusPublished = "published"
+)
+
 type Post struct {
 	ID        int64        `json:"id"`
 	Content   string       `json:"content"`
@@ -19,6 +28,29 @@ type Post struct {
 	UpdatedAt sql.NullTime `json:"updated_at"`
 	Comments  []Comment    `json:"comments"`
 	User      User         `json:"user"`
+	MediaIDs  []int64      `json:"-"`
+	Media     []Media      `json:"media"`
+	// Edited and EditedAt tell clients the post changed since it was
+	// published, see GetRevisions for the history
+	Edited   bool       `json:"edited"`
+	EditedAt *time.Time `json:"edited_at,omitempty"`
+	// Status is one of the PostStatus constants. Drafts and scheduled posts
+	// are only visible to their author; scheduled ones get published at
+	// PublishAt by PublishDue.
+	Status    string     `json:"status"`
+	PublishAt *time.Time `json:"publish_at,omitempty"`
+	// DeletedAt is only set on posts returned by GetDeletedByID.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// a post either reposts or quotes another one, never both
+	RepostOfID   *int64       `json:"-"`
+	QuotedPostID *int64       `json:"-"`
+	RepostOf     *PostPreview `json:"repost_of,omitempty"`
+	QuotedPost   *PostPreview `json:"quoted_post,omitempty"`
+	// the viewer dependent fields are only filled in by GetByID and
+	// GetUserFeed
+	LikesCount     int  `json:"likes_count"`
+	LikedByMe      bool `json:"liked_by_me"`
+	BookmarkedByMe bool `json:"bookmarked_by_me"`
 }
 
 type PostWithMetadata struct {
@@ -30,29 +62,104 @@ type PostsStore struct {
 	db *sql.DB
 }
 
+// Create inserts the post and attaches the media referenced by MediaIDs in
+// the same transaction. Posts without a Status are published right away.
+// ErrNotFound is returned when one of the media does not exist, was not
+// uploaded by the author of the post, failed processing or is already
+// attached to another post.
 func (s *PostsStore) Create(ctx context.Context, post *Post) error {
-	query := "INSERT INTO posts (content, title, user_id, version, tags) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at, updated_at;"
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			INSERT INTO posts (content, title, user_id, version, tags, quoted_post_id, status, publish_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			RETURNING id, created_at, updated_at;
+		`
 
-	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
-	defer cancel()
+		if post.Status == "" {
+			post.Status = PostStatusPublished
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+		defer cancel()
+
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			post.Content,
+			post.Title,
+			post.UserID,
+			post.Version,
+			pq.Array(post.Tags),
+			post.QuotedPostID,
+			post.Status,
+			post.PublishAt,
+		).Scan(&post.ID, &post.CreatedAt, &post.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		return attachMedia(ctx, tx, post)
+	})
+}
+
+func attachMedia(ctx context.Context, tx *sql.Tx, post *Post) error {
+	if len(post.MediaIDs) == 0 {
+		return nil
+	}
+
+	unique := make(map[int64]struct{}, len(post.MediaIDs))
+	for _, id := range post.MediaIDs {
+		unique[id] = struct{}{}
+	}
 
-	err := s.db.QueryRowContext(ctx, query, post.Content, post.Title, post.UserID, post.Version, pq.Array(post.Tags)).Scan(&post.ID, &post.CreatedAt, &post.UpdatedAt)
+	query := `
+		INSERT INTO post_media (post_id, media_id, position)
+		SELECT $1, m.id, array_position($2::bigint[], m.id)
+		FROM media m
+		WHERE m.id = ANY($2::bigint[]) AND m.user_id = $3 AND m.status <> 'failed'
+			AND NOT EXISTS (SELECT 1 FROM post_media pm WHERE pm.media_id = m.id)
+	`
+
+	res, err := tx.ExecContext(ctx, query, post.ID, pq.Array(post.MediaIDs), post.UserID)
 	if err != nil {
 		return err
 	}
 
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows != int64(len(unique)) {
+		return ErrNotFound
+	}
+
 	return nil
 }
 
-func (s *PostsStore) GetByID(ctx context.Context, id int64) (*Post, error) {
-	query := `SELECT id, content, title, user_id, version,  tags, updated_at, created_at FROM posts WHERE id = $1;`
+// GetByID returns the post as seen by viewerID (0 for anonymous viewers).
+// Posts of private accounts are reported as ErrNotFound unless the viewer is
+// the author or one of their followers, and so are posts of users who blocked
+// the viewer or were blocked by them, and unpublished posts of other users.
+func (s *PostsStore) GetByID(ctx context.Context, id int64, viewerID int64) (*Post, error) {
+	query := `
+		SELECT p.id, p.content, p.title, p.user_id, p.version, p.tags, p.created_at, p.updated_at, p.edited_at, u.username,
+			p.status, p.publish_at, ` + likesCount + `, ` + likedBy("COALESCE(p.repost_of_id, p.id)", "$2") + `, ` + bookmarkedBy("p.id", "$2") + `,
+			` + referencedPostColumns("$2") + `
+		FROM posts p
+		JOIN users u ON p.user_id = u.id
+		` + referencedPostJoin + `
+		WHERE p.id = $1 AND ` + livePost + ` AND (p.status = 'published' OR p.user_id = $2) AND ` + visibleTo("p.user_id", "u.is_private", "$2") + ` AND ` + notBlocked("p.user_id", "$2") + `;
+	`
 
 	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
 	defer cancel()
 
-	var post Post
+	var (
+		post Post
+		ref  postRef
+	)
 
-	err := s.db.QueryRowContext(ctx, query, id).Scan(
+	dest := []any{
 		&post.ID,
 		&post.Content,
 		&post.Title,
@@ -61,8 +168,15 @@ func (s *PostsStore) GetByID(ctx context.Context, id int64) (*Post, error) {
 		pq.Array(&post.Tags),
 		&post.CreatedAt,
 		&post.UpdatedAt,
-	)
-
+		&post.EditedAt,
+		&post.User.Username,
+		&post.Status,
+		&post.PublishAt,
+		&post.LikesCount,
+		&post.LikedByMe,
+		&post.BookmarkedByMe,
+	}
+	err := s.db.QueryRowContext(ctx, query, id, viewerID).Scan(append(dest, ref.dest(&post)...)...)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -72,39 +186,168 @@ func (s *PostsStore) GetByID(ctx context.Context, id int64) (*Post, error) {
 		}
 
 	}
+	post.User.ID = post.UserID
+	post.markEdited()
+	ref.attach(&post)
 	return &post, nil
 }
 
+// livePost is the SQL condition leaving out soft deleted posts and reposts of
+// them. It expects the post as p and the reposted one as rp, see
+// referencedPostJoin.
+const livePost = "p.deleted_at IS NULL AND (p.repost_of_id IS NULL OR rp.deleted_at IS NULL)"
+
+// visibleTo returns the SQL condition hiding content of private accounts from
+// viewers that neither own it nor follow its author.
+func visibleTo(authorCol, isPrivateCol, viewer string) string {
+	return fmt.Sprintf(
+		"(NOT %[2]s OR %[1]s = %[3]s OR EXISTS (SELECT 1 FROM followers vf WHERE vf.user_id = %[1]s AND vf.follower_id = %[3]s))",
+		authorCol, isPrivateCol, viewer,
+	)
+}
+
+// Update saves the post only if its version still matches the stored one and
+// scans the incremented version back into post. The previous version is kept
+// in post_revisions within the same transaction. ErrEditConflict is returned
+// when the post was modified (or deleted) concurrently.
+//
+// Publishing a draft or scheduled post resets its creation time, so it
+// surfaces at the top of feeds.
 func (s *PostsStore) Update(ctx context.Context, post *Post) error {
-	query := "UPDATE posts SET title = $1, content = $2, version = version + 1 WHERE id = $3 AND version = $4 RETURNING version;"
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+		defer cancel()
+
+		if err := saveRevision(ctx, tx, post.ID, post.Version); err != nil {
+			return err
+		}
+
+		query := `
+			UPDATE posts SET title = $1, content = $2, version = version + 1, updated_at = NOW(),
+				created_at = CASE WHEN status <> 'published' AND $5 = 'published' THEN NOW() ELSE created_at END,
+				edited_at = CASE WHEN status = 'published' THEN NOW() ELSE edited_at END,
+				status = $5, publish_at = $6
+			WHERE id = $3 AND version = $4 AND deleted_at IS NULL
+			RETURNING version, created_at, updated_at, edited_at;
+		`
+
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			post.Title,
+			post.Content,
+			post.ID,
+			post.Version,
+			post.Status,
+			post.PublishAt,
+		).Scan(&post.Version, &post.CreatedAt, &post.UpdatedAt, &post.EditedAt)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrEditConflict
+			default:
+				return err
+			}
+		}
+		post.markEdited()
+
+		return nil
+	})
+}
+
+// markEdited sets Edited from EditedAt, which Update only sets when it
+// overwrites a published version. Publishing a draft doesn't count as an edit.
+func (p *Post) markEdited() {
+	p.Edited = p.EditedAt != nil
+}
+
+// Delete soft deletes the post. It disappears from reads right away but can be
+// restored until PurgeDeleted removes it for good.
+func (s *PostsStore) Delete(ctx context.Context, postID int64) error {
+	query := "UPDATE posts SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL;"
 
 	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
 	defer cancel()
 
-	_, err := s.db.ExecContext(ctx, query, post.Title, post.Content, post.ID, post.Version)
+	res, err := s.db.ExecContext(ctx, query, postID)
+	if err != nil {
+		return err
+
+	}
+	rows, err := res.RowsAffected()
 	if err != nil {
 		return err
 	}
 
+	if rows == 0 {
+		return ErrNotFound
+	}
+
 	return nil
 }
 
-func (s *PostsStore) Delete(ctx context.Context, postID int64) error {
-	query := "DELETE FROM posts WHERE id = $1;"
+// GetDeletedByID returns a post soft deleted less than within ago, so it can be
+// checked before restoring it. Live posts and posts deleted earlier are
+// reported as ErrNotFound.
+func (s *PostsStore) GetDeletedByID(ctx context.Context, id int64, within time.Duration) (*Post, error) {
+	query := `
+		SELECT p.id, p.content, p.title, p.user_id, p.version, p.tags, p.created_at, p.updated_at, p.edited_at, p.deleted_at, u.username,
+			p.status, p.publish_at
+		FROM posts p
+		JOIN users u ON p.user_id = u.id
+		WHERE p.id = $1 AND p.deleted_at > NOW() - make_interval(secs => $2);
+	`
 
 	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
 	defer cancel()
 
-	res, err := s.db.ExecContext(ctx, query, postID)
+	var post Post
+	err := s.db.QueryRowContext(ctx, query, id, within.Seconds()).Scan(
+		&post.ID,
+		&post.Content,
+		&post.Title,
+		&post.UserID,
+		&post.Version,
+		pq.Array(&post.Tags),
+		&post.CreatedAt,
+		&post.UpdatedAt,
+		&post.EditedAt,
+		&post.DeletedAt,
+		&post.User.Username,
+		&post.Status,
+		&post.PublishAt,
+	)
 	if err != nil {
-		return err
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	post.User.ID = post.UserID
+	post.markEdited()
+	return &post, nil
+}
+
+// Restore undoes the soft delete of a post deleted less than within ago.
+// ErrConflict is returned when the post is a repost and the user reposted the
+// original again in the meantime.
+func (s *PostsStore) Restore(ctx context.Context, id int64, within time.Duration) error {
+	query := `UPDATE posts SET deleted_at = NULL WHERE id = $1 AND deleted_at > NOW() - make_interval(secs => $2);`
 
+	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, id, within.Seconds())
+	if err := relationInsertError(err); err != nil {
+		return err
 	}
+
 	rows, err := res.RowsAffected()
 	if err != nil {
 		return err
 	}
-
 	if rows == 0 {
 		return ErrNotFound
 	}
@@ -112,48 +355,131 @@ func (s *PostsStore) Delete(ctx context.Context, postID int64) error {
 	return nil
 }
 
-func (s *PostsStore) GetUserFeed(ctx context.Context, id int64, fq PaginatedFeedQuery) ([]PostWithMetadata, error) {
+// PurgeDeleted hard deletes up to limit posts that were soft deleted more
+// than olderThan ago, together with their comments, likes and reposts, and
+// returns how many were removed.
+func (s *PostsStore) PurgeDeleted(ctx context.Context, olderThan time.Duration, limit int) (int64, error) {
+	query := `
+		DELETE FROM posts
+		WHERE id IN (
+			SELECT id FROM posts
+			WHERE deleted_at < NOW() - make_interval(secs => $1)
+			ORDER BY deleted_at
+			LIMIT $2
+		);
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, olderThan.Seconds(), limit)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// GetUserFeed returns the posts written by the user together with the posts
+// of every account the user follows, leaving out blocked and muted authors.
+func (s *PostsStore) GetUserFeed(ctx context.Context, id int64, fq PaginatedFeedQuery) ([]PostWithMetadata, Pagination, error) {
+	args := []any{id}
+	conditions := []string{
+		"(p.user_id = $1 OR EXISTS (SELECT 1 FROM followers f WHERE f.user_id = p.user_id AND f.follower_id = $1))",
+		livePost,
+		"p.status = 'published'",
+		notBlocked("p.user_id", "$1"),
+		notMuted("p.user_id", "$1"),
+	}
+
+	if len(fq.Tags) > 0 {
+		args = append(args, pq.Array(fq.Tags))
+		conditions = append(conditions, fmt.Sprintf("p.tags && $%d", len(args)))
+	}
+
+	if fq.Search != "" {
+		args = append(args, fq.Search)
+		conditions = append(conditions, fmt.Sprintf("(p.title ILIKE '%%' || $%d || '%%' OR p.content ILIKE '%%' || $%d || '%%')", len(args), len(args)))
+	}
+
+	if fq.Since != "" {
+		args = append(args, fq.Since)
+		conditions = append(conditions, fmt.Sprintf("p.created_at >= $%d", len(args)))
+	}
+
+	if fq.Until != "" {
+		args = append(args, fq.Until)
+		conditions = append(conditions, fmt.Sprintf("p.created_at <= $%d", len(args)))
+	}
+
+	if fq.Cursor != nil {
+		args = append(args, fq.Cursor.CreatedAt, fq.Cursor.ID)
+		conditions = append(conditions, keysetCondition("p.created_at", "p.id", fq.Sort, len(args)-1))
+	}
+
+	args = append(args, fq.Limit+1, fq.Offset)
+
 	query := `
 		SELECT
-			p.id,p.user_id,p.title,p.content,p.created_at, p.version, p.tags, u.username,
-			COUNT(c.id) AS comments_count
+			p.id,p.user_id,p.title,p.content,p.created_at, p.updated_at, p.edited_at, p.version, p.tags, u.username, p.status,
+			COUNT(c.id) AS comments_count, ` + likesCount + `, ` + likedBy("COALESCE(p.repost_of_id, p.id)", "$1") + `, ` + bookmarkedBy("p.id", "$1") + `,
+			` + referencedPostColumns("$1") + `
 		FROM posts p
-		LEFT JOIN comments c ON p.id = c.post_id
+		LEFT JOIN comments c ON p.id = c.post_id AND c.deleted_at IS NULL AND ` + notBlocked("c.user_id", "$1") + ` AND ` + notMuted("c.user_id", "$1") + `
 		LEFT JOIN users u ON p.user_id = u.id
-		JOIN followers f ON p.user_id = f.follower_id
-		WHERE f.user_id = $1 OR p.user_id = $1
-		GROUP BY p.id, u.username
-		ORDER BY p.created_at ` + fq.Sort + `
-		LIMIT $2 OFFSET $3;
+		` + referencedPostJoin + `
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		GROUP BY p.id, u.username, rp.id, ru.id
+		ORDER BY p.created_at ` + fq.Sort + `, p.id ` + fq.Sort + `
+		LIMIT $` + strconv.Itoa(len(args)-1) + ` OFFSET $` + strconv.Itoa(len(args)) + `;
 	`
 	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
 	defer cancel()
 
-	rows, err := s.db.QueryContext(ctx, query, id, fq.Limit, fq.Offset)
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, Pagination{}, err
 	}
 
 	defer rows.Close()
-	var feeds []PostWithMetadata
+	feeds := []PostWithMetadata{}
 	for rows.Next() {
-		var post PostWithMetadata
-		err = rows.Scan(
+		var (
+			post PostWithMetadata
+			ref  postRef
+		)
+		dest := []any{
 			&post.ID,
 			&post.UserID,
 			&post.Title,
 			&post.Content,
 			&post.CreatedAt,
+			&post.UpdatedAt,
+			&post.EditedAt,
 			&post.Version,
 			pq.Array(&post.Tags),
 			&post.User.Username,
+			&post.Status,
 			&post.CommentsCount,
-		)
-		if err != nil {
-			return nil, err
+			&post.LikesCount,
+			&post.LikedByMe,
+			&post.BookmarkedByMe,
 		}
+		if err := rows.Scan(append(dest, ref.dest(&post.Post)...)...); err != nil {
+			return nil, Pagination{}, err
+		}
+		post.markEdited()
+		ref.attach(&post.Post)
 
 		feeds = append(feeds, post)
 	}
-	return feeds, nil
+	if err := rows.Err(); err != nil {
+		return nil, Pagination{}, err
+	}
+
+	// without an offset the first page already hands out a cursor for the next
+	feeds, pagination := newPagination(feeds, fq.Limit, fq.Offset, fq.Offset == 0, func(p PostWithMetadata) Cursor {
+		return Cursor{CreatedAt: p.CreatedAt, ID: p.ID}
+	})
+	return feeds, pagination, nil
 }
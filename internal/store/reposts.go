@@ -0,0 +1,165 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"time"
+)
+
+// PostPreview is the embedded version of a reposted or quoted post. Posts
+// that were deleted, or that the viewer may not see, are reduced to a stub
+// with Unavailable set.
+type PostPreview struct {
+	ID          int64      `json:"id"`
+	Title       string     `json:"title,omitempty"`
+	Content     string     `json:"content,omitempty"`
+	Tags        []string   `json:"tags,omitempty"`
+	User        *User      `json:"user,omitempty"`
+	CreatedAt   *time.Time `json:"created_at,omitempty"`
+	Unavailable bool       `json:"unavailable,omitempty"`
+}
+
+// Preview returns the embeddable version of the post.
+func (p *Post) Preview() *PostPreview {
+	createdAt := p.CreatedAt
+	return &PostPreview{
+		ID:        p.ID,
+		Title:     p.Title,
+		Content:   p.Content,
+		Tags:      p.Tags,
+		User:      &User{ID: p.UserID, Username: p.User.Username},
+		CreatedAt: &createdAt,
+	}
+}
+
+// Repost shares postID on behalf of userID as a post of its own, so it shows
+// up in the feeds of their followers. Reposting a repost shares the original
+// instead. ErrConflict is returned when the user already reposted it.
+func (s *PostsStore) Repost(ctx context.Context, userID int64, postID int64) (*Post, error) {
+	query := `
+		INSERT INTO posts (title, content, user_id, version, tags, repost_of_id)
+		SELECT '', '', $1, 0, '{}', COALESCE(p.repost_of_id, p.id)
+		FROM posts p
+		WHERE p.id = $2 AND p.deleted_at IS NULL AND p.status = 'published'
+		RETURNING id, created_at, updated_at, repost_of_id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+	defer cancel()
+
+	post := &Post{UserID: userID, Tags: []string{}, Status: PostStatusPublished}
+	err := s.db.QueryRowContext(ctx, query, userID, postID).Scan(&post.ID, &post.CreatedAt, &post.UpdatedAt, &post.RepostOfID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, relationInsertError(err)
+		}
+	}
+
+	return post, nil
+}
+
+// Unrepost soft deletes the repost of postID, or of the original it reposts,
+// made by userID, the same way Delete removes any other post.
+func (s *PostsStore) Unrepost(ctx context.Context, userID int64, postID int64) error {
+	query := `
+		UPDATE posts SET deleted_at = NOW()
+		WHERE user_id = $1 AND deleted_at IS NULL
+			AND repost_of_id = (SELECT COALESCE(repost_of_id, id) FROM posts WHERE id = $2)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userID, postID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// referencedPostJoin joins the post reposted or quoted by p as rp, and its
+// author as ru.
+const referencedPostJoin = `
+	LEFT JOIN posts rp ON rp.id = COALESCE(p.repost_of_id, p.quoted_post_id)
+	LEFT JOIN users ru ON ru.id = rp.user_id
+`
+
+// referencedPostColumns selects the columns scanned by postRef, checking
+// whether viewer may see the referenced post.
+func referencedPostColumns(viewer string) string {
+	return `p.repost_of_id, p.quoted_post_id, rp.id, rp.title, rp.content, rp.tags, rp.created_at, ru.id, ru.username,
+		(rp.id IS NOT NULL AND rp.deleted_at IS NULL AND rp.status = 'published' AND ` + visibleTo("rp.user_id", "ru.is_private", viewer) + ` AND ` + notBlocked("rp.user_id", viewer) + `)`
+}
+
+// postRef holds the scanned referencedPostColumns until they are attached to
+// the post.
+type postRef struct {
+	id        sql.NullInt64
+	title     sql.NullString
+	content   sql.NullString
+	tags      []string
+	createdAt sql.NullTime
+	userID    sql.NullInt64
+	username  sql.NullString
+	visible   bool
+}
+
+func (r *postRef) dest(post *Post) []any {
+	return []any{
+		&post.RepostOfID,
+		&post.QuotedPostID,
+		&r.id,
+		&r.title,
+		&r.content,
+		pq.Array(&r.tags),
+		&r.createdAt,
+		&r.userID,
+		&r.username,
+		&r.visible,
+	}
+}
+
+// attach sets the repost or quote preview of post.
+func (r *postRef) attach(post *Post) {
+	var (
+		refID  int64
+		target **PostPreview
+	)
+	switch {
+	case post.RepostOfID != nil:
+		refID, target = *post.RepostOfID, &post.RepostOf
+	case post.QuotedPostID != nil:
+		refID, target = *post.QuotedPostID, &post.QuotedPost
+	default:
+		return
+	}
+
+	if !r.visible {
+		*target = &PostPreview{ID: refID, Unavailable: true}
+		return
+	}
+
+	createdAt := r.createdAt.Time
+	*target = &PostPreview{
+		ID:        refID,
+		Title:     r.title.String,
+		Content:   r.content.String,
+		Tags:      r.tags,
+		User:      &User{ID: r.userID.Int64, Username: r.username.String},
+		CreatedAt: &createdAt,
+	}
+}
@@ -0,0 +1,113 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// PostRevision is the title and content of a post as of one of its versions.
+type PostRevision struct {
+	PostID    int64     `json:"post_id"`
+	Version   int64     `json:"version"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// revisionsQuery selects the earlier versions of a post stored in
+// post_revisions together with its current version, as seen by viewer $2.
+// Versions written before the post was published are only shown to its
+// author.
+const revisionsQuery = `
+	SELECT r.post_id, r.version, r.title, r.content, r.created_at
+	FROM post_revisions r
+	JOIN posts p ON p.id = r.post_id
+	WHERE r.post_id = $1 AND (r.status = 'published' OR p.user_id = $2)
+	UNION ALL
+	SELECT p.id, p.version, p.title, p.content, ` + versionCreatedAt + ` FROM posts p WHERE p.id = $1
+`
+
+// versionCreatedAt is when the current version of post p was written.
+const versionCreatedAt = `CASE WHEN p.version = 0 THEN p.created_at ELSE COALESCE(p.updated_at, p.created_at) END`
+
+// GetRevisions returns every version of the post viewerID may see, newest
+// first.
+func (s *PostsStore) GetRevisions(ctx context.Context, postID int64, viewerID int64) ([]PostRevision, error) {
+	query := `SELECT * FROM (` + revisionsQuery + `) r ORDER BY version DESC`
+
+	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, postID, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []PostRevision{}
+	for rows.Next() {
+		var rev PostRevision
+		if err := rows.Scan(&rev.PostID, &rev.Version, &rev.Title, &rev.Content, &rev.CreatedAt); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+
+	return revisions, rows.Err()
+}
+
+// GetRevision returns the post as of version, which may be the current one.
+// Versions viewerID may not see are reported as ErrNotFound.
+func (s *PostsStore) GetRevision(ctx context.Context, postID int64, version int64, viewerID int64) (*PostRevision, error) {
+	query := `SELECT * FROM (` + revisionsQuery + `) r WHERE version = $3`
+
+	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+	defer cancel()
+
+	var rev PostRevision
+	err := s.db.QueryRowContext(ctx, query, postID, viewerID, version).Scan(&rev.PostID, &rev.Version, &rev.Title, &rev.Content, &rev.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &rev, nil
+}
+
+// saveRevision copies the post as of version into post_revisions before it
+// gets overwritten. The post stays locked until tx ends, so PublishDue skips
+// it meanwhile. It returns ErrEditConflict when the post is no longer at that
+// version, or another update already saved it.
+func saveRevision(ctx context.Context, tx *sql.Tx, postID int64, version int64) error {
+	query := `
+		INSERT INTO post_revisions (post_id, version, title, content, created_at, status)
+		SELECT p.id, p.version, p.title, p.content, ` + versionCreatedAt + `, p.status
+		FROM posts p
+		WHERE p.id = $1 AND p.version = $2
+		FOR UPDATE
+	`
+
+	res, err := tx.ExecContext(ctx, query, postID, version)
+	if err := relationInsertError(err); err != nil {
+		if errors.Is(err, ErrConflict) {
+			return ErrEditConflict
+		}
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
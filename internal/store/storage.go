@@ -11,27 +11,83 @@ var (
 	DatabaseQueryTimeout = 15 * time.Second
 	ErrNotFound          = errors.New("record not found")
 	ErrConflict          = errors.New("resource already exists")
+	ErrEditConflict      = errors.New("edit conflict")
 )
 
 type Storage struct {
 	Posts interface {
-		GetByID(ctx context.Context, id int64) (*Post, error)
+		GetByID(ctx context.Context, id int64, viewerID int64) (*Post, error)
 		Create(context.Context, *Post) error
 		Delete(context.Context, int64) error
 		Update(context.Context, *Post) error
-		GetUserFeed(ctx context.Context, id int64, fq PaginatedFeedQuery) ([]PostWithMetadata, error)
+		GetUserFeed(ctx context.Context, id int64, fq PaginatedFeedQuery) ([]PostWithMetadata, Pagination, error)
+		Repost(ctx context.Context, userID int64, postID int64) (*Post, error)
+		Unrepost(ctx context.Context, userID int64, postID int64) error
+		GetRevisions(ctx context.Context, postID int64, viewerID int64) ([]PostRevision, error)
+		GetRevision(ctx context.Context, postID int64, version int64, viewerID int64) (*PostRevision, error)
+		GetDeletedByID(ctx context.Context, id int64, within time.Duration) (*Post, error)
+		Restore(ctx context.Context, id int64, within time.Duration) error
+		PurgeDeleted(ctx context.Context, olderThan time.Duration, limit int) (int64, error)
+		GetDrafts(ctx context.Context, userID int64, q PaginatedQuery) ([]Post, Pagination, error)
+		PublishDue(ctx context.Context, limit int) (int64, error)
 	}
 	Users interface {
 		Create(context.Context, *User) error
 		GetByID(ctx context.Context, id int64) (*User, error)
+		GetByEmail(ctx context.Context, email string) (*User, error)
+		GetByUsername(ctx context.Context, username string) (*User, error)
+		Update(context.Context, *User) error
+		CreateAndInvite(ctx context.Context, user *User, token string, invitationExp time.Duration) error
+		Activate(ctx context.Context, token string) error
+		Delete(ctx context.Context, id int64) error
+		SetPrivate(ctx context.Context, id int64, isPrivate bool) error
 	}
 	Comments interface {
 		Create(context.Context, *Comment) error
-		GetByPostID(context.Context, int64) ([]Comment, error)
+		GetByID(ctx context.Context, id int64, viewerID int64) (*Comment, error)
+		Update(context.Context, *Comment) error
+		Delete(ctx context.Context, id int64) error
+		GetByPostID(ctx context.Context, postID int64, viewerID int64) ([]Comment, error)
+		ListByPostID(ctx context.Context, postID int64, viewerID int64, q PaginatedQuery) ([]Comment, Pagination, error)
 	}
 	Followers interface {
-		Follow(ctx context.Context, followerID int64, userID int64) error
+		Follow(ctx context.Context, followerID int64, userID int64) (FollowState, error)
 		Unfollow(ctx context.Context, followerID int64, userID int64) error
+		GetFollowers(ctx context.Context, userID int64, viewerID int64, q PaginatedQuery) ([]FollowUser, Pagination, error)
+		GetFollowing(ctx context.Context, userID int64, viewerID int64, q PaginatedQuery) ([]FollowUser, Pagination, error)
+		GetFollowRequests(ctx context.Context, userID int64, q PaginatedQuery) ([]FollowRequest, Pagination, error)
+		ApproveFollowRequest(ctx context.Context, userID int64, requesterID int64) error
+		RejectFollowRequest(ctx context.Context, userID int64, requesterID int64) error
+	}
+	Roles interface {
+		GetByName(ctx context.Context, name string) (*Role, error)
+	}
+	Media interface {
+		Create(context.Context, *Media) error
+		GetByID(ctx context.Context, id int64) (*Media, error)
+		GetByPostID(ctx context.Context, postID int64) ([]Media, error)
+		ClaimPending(ctx context.Context, limit int) ([]Media, error)
+		MarkReady(context.Context, *Media) error
+		MarkFailed(ctx context.Context, media *Media, reason string, retry bool) error
+	}
+	Likes interface {
+		Like(ctx context.Context, postID int64, userID int64) (LikeState, error)
+		Unlike(ctx context.Context, postID int64, userID int64) (LikeState, error)
+	}
+	Bookmarks interface {
+		Save(ctx context.Context, userID int64, postID int64, folderID *int64) (*Bookmark, error)
+		Remove(ctx context.Context, userID int64, postID int64) error
+		List(ctx context.Context, userID int64, folderID *int64, q PaginatedQuery) ([]Bookmark, Pagination, error)
+		CreateFolder(context.Context, *BookmarkFolder) error
+		GetFolders(ctx context.Context, userID int64) ([]BookmarkFolder, error)
+		DeleteFolder(ctx context.Context, userID int64, folderID int64) error
+	}
+	Blocks interface {
+		Block(ctx context.Context, blockerID int64, blockedID int64) error
+		Unblock(ctx context.Context, blockerID int64, blockedID int64) error
+		Mute(ctx context.Context, muterID int64, mutedID int64) error
+		Unmute(ctx context.Context, muterID int64, mutedID int64) error
+		IsBlocked(ctx context.Context, userID int64, otherID int64) (bool, error)
 	}
 }
 
@@ -41,5 +97,24 @@ func NewPostgresStorage(db *sql.DB) Storage {
 		Users:     &UsersStore{db: db},
 		Comments:  &CommentsStore{db: db},
 		Followers: &FollowersStore{db: db},
+		Roles:     &RolesStore{db: db},
+		Blocks:    &BlocksStore{db: db},
+		Media:     &MediaStore{db: db},
+		Likes:     &LikesStore{db: db},
+		Bookmarks: &BookmarksStore{db: db},
 	}
 }
+
+func withTx(db *sql.DB, ctx context.Context, fn func(*sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -2,31 +2,115 @@ package store
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
 	"errors"
+	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
 	"time"
 )
 
+var (
+	ErrDuplicateEmail    = errors.New("a user with that email already exists")
+	ErrDuplicateUsername = errors.New("a user with that username already exists")
+)
+
 type User struct {
 	ID        int64        `json:"id"`
 	Username  string       `json:"username"`
 	Email     string       `json:"email"`
-	Password  string       `json:"-"`
+	Password  password     `json:"-"`
+	IsActive  bool         `json:"is_active"`
+	IsPrivate bool         `json:"is_private"`
+	RoleID    int64        `json:"role_id"`
+	Role      Role         `json:"role"`
 	CreatedAt time.Time    `json:"created_at"`
 	UpdatedAt sql.NullTime `json:"updated_at"`
+
+	DisplayName       string       `json:"display_name"`
+	Bio               string       `json:"bio"`
+	Location          string       `json:"location"`
+	Website           string       `json:"website"`
+	AvatarURL         string       `json:"avatar_url"`
+	UsernameChangedAt sql.NullTime `json:"-"`
+
+	FollowersCount int64 `json:"followers_count"`
+	FollowingCount int64 `json:"following_count"`
+	PostsCount     int64 `json:"posts_count"`
+}
+
+// UsernameChangeCooldown is the minimum time between two username changes.
+const UsernameChangeCooldown = 30 * 24 * time.Hour
+
+// UsernameChangeAllowedAt returns when the user may change their username
+// again. The zero time means right away.
+func (u *User) UsernameChangeAllowedAt() time.Time {
+	if !u.UsernameChangedAt.Valid {
+		return time.Time{}
+	}
+	return u.UsernameChangedAt.Time.Add(UsernameChangeCooldown)
+}
+
+type password struct {
+	text *string
+	hash []byte
+}
+
+func (p *password) Set(text string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(text), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	p.text = &text
+	p.hash = hash
+
+	return nil
+}
+
+func (p *password) Matches(text string) bool {
+	return bcrypt.CompareHashAndPassword(p.hash, []byte(text)) == nil
 }
+
 type UsersStore struct {
 	db *sql.DB
 }
 
 func (s *UsersStore) Create(ctx context.Context, user *User) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return s.create(ctx, tx, user)
+	})
+}
+
+func (s *UsersStore) create(ctx context.Context, tx *sql.Tx, user *User) error {
+
+	query := `
+		INSERT INTO users (username, email, password, is_active, role_id)
+		VALUES ($1, $2, $3, $4, (SELECT id FROM roles WHERE name = $5))
+		RETURNING id, role_id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+	defer cancel()
 
-	query := "INSERT INTO users (username, email, password) VALUES ($1, $2, $3) RETURNING id, created_at"
+	role := user.Role.Name
+	if role == "" {
+		role = "user"
+	}
 
-	err := s.db.QueryRowContext(ctx, query, user.Username, user.Email, user.Password).Scan(
-		&user.ID, &user.CreatedAt)
+	err := tx.QueryRowContext(ctx, query, user.Username, user.Email, user.Password.hash, user.IsActive, role).Scan(
+		&user.ID, &user.RoleID, &user.CreatedAt)
 
 	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			switch pqErr.Constraint {
+			case "users_email_key":
+				return ErrDuplicateEmail
+			case "users_username_key":
+				return ErrDuplicateUsername
+			}
+		}
 		return err
 	}
 	return nil
@@ -34,17 +118,78 @@ func (s *UsersStore) Create(ctx context.Context, user *User) error {
 }
 
 func (s *UsersStore) GetByID(ctx context.Context, id int64) (*User, error) {
-	query := "SELECT id, username, email, created_at FROM users WHERE id = $1"
+	return s.getBy(ctx, "u.id = $1", id)
+}
+
+func (s *UsersStore) GetByUsername(ctx context.Context, username string) (*User, error) {
+	return s.getBy(ctx, "u.username = $1", username)
+}
+
+func (s *UsersStore) getBy(ctx context.Context, where string, arg any) (*User, error) {
+	query := `
+		SELECT u.id, u.username, u.email, u.is_active, u.is_private, u.created_at, u.updated_at, r.id, r.name, r.level, r.description,
+			u.followers_count, u.following_count, (SELECT COUNT(*) FROM posts p WHERE p.user_id = u.id AND p.deleted_at IS NULL AND p.status = 'published'),
+			u.display_name, u.bio, u.location, u.website, u.avatar_url, u.username_changed_at
+		FROM users u
+		JOIN roles r ON u.role_id = r.id
+		WHERE ` + where
+
+	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+	defer cancel()
+
+	u := &User{}
+
+	err := s.db.QueryRowContext(ctx, query, arg).Scan(
+		&u.ID,
+		&u.Username,
+		&u.Email,
+		&u.IsActive,
+		&u.IsPrivate,
+		&u.CreatedAt,
+		&u.UpdatedAt,
+		&u.Role.ID,
+		&u.Role.Name,
+		&u.Role.Level,
+		&u.Role.Description,
+		&u.FollowersCount,
+		&u.FollowingCount,
+		&u.PostsCount,
+		&u.DisplayName,
+		&u.Bio,
+		&u.Location,
+		&u.Website,
+		&u.AvatarURL,
+		&u.UsernameChangedAt,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+
+	}
+	u.RoleID = u.Role.ID
+	return u, nil
+
+}
+
+func (s *UsersStore) GetByEmail(ctx context.Context, email string) (*User, error) {
+	query := "SELECT id, username, email, password, is_active, created_at FROM users WHERE email = $1"
 
 	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
 	defer cancel()
 
 	u := &User{}
 
-	err := s.db.QueryRowContext(ctx, query, id).Scan(
+	err := s.db.QueryRowContext(ctx, query, email).Scan(
 		&u.ID,
 		&u.Username,
 		&u.Email,
+		&u.Password.hash,
+		&u.IsActive,
 		&u.CreatedAt,
 	)
 
@@ -58,5 +203,228 @@ func (s *UsersStore) GetByID(ctx context.Context, id int64) (*User, error) {
 
 	}
 	return u, nil
+}
+
+// CreateAndInvite creates the user and its activation invitation in a single
+// transaction. Only the SHA-256 hash of the token is persisted.
+func (s *UsersStore) CreateAndInvite(ctx context.Context, user *User, token string, invitationExp time.Duration) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := s.create(ctx, tx, user); err != nil {
+			return err
+		}
+
+		return s.createUserInvitation(ctx, tx, token, invitationExp, user.ID)
+	})
+}
+
+func (s *UsersStore) createUserInvitation(ctx context.Context, tx *sql.Tx, token string, exp time.Duration, userID int64) error {
+	query := "INSERT INTO user_invitations (token, user_id, expiry) VALUES ($1, $2, $3)"
+
+	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, hashToken(token), userID, time.Now().Add(exp))
+	return err
+}
+
+// Activate marks the user owning a non-expired invitation token as active and
+// removes its invitations.
+func (s *UsersStore) Activate(ctx context.Context, token string) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		user, err := s.getUserFromInvitation(ctx, tx, token)
+		if err != nil {
+			return err
+		}
+
+		user.IsActive = true
+		if err := s.update(ctx, tx, user); err != nil {
+			return err
+		}
+
+		return s.deleteUserInvitations(ctx, tx, user.ID)
+	})
+}
+
+func (s *UsersStore) getUserFromInvitation(ctx context.Context, tx *sql.Tx, token string) (*User, error) {
+	query := `
+		SELECT u.id, u.username, u.email, u.is_active, u.created_at
+		FROM users u
+		JOIN user_invitations ui ON u.id = ui.user_id
+		WHERE ui.token = $1 AND ui.expiry > $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+	defer cancel()
+
+	u := &User{}
+	err := tx.QueryRowContext(ctx, query, hashToken(token), time.Now()).Scan(
+		&u.ID,
+		&u.Username,
+		&u.Email,
+		&u.IsActive,
+		&u.CreatedAt,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return u, nil
+}
+
+func (s *UsersStore) update(ctx context.Context, tx *sql.Tx, user *User) error {
+	query := "UPDATE users SET username = $1, email = $2, is_active = $3, updated_at = NOW() WHERE id = $4"
+
+	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, user.Username, user.Email, user.IsActive, user.ID)
+	return err
+}
+
+func (s *UsersStore) deleteUserInvitations(ctx context.Context, tx *sql.Tx, userID int64) error {
+	query := "DELETE FROM user_invitations WHERE user_id = $1"
+
+	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, userID)
+	return err
+}
+
+// Delete removes the user together with its invitations. It is used to roll
+// back a registration whose invitation email could not be delivered.
+func (s *UsersStore) Delete(ctx context.Context, id int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := s.deleteUserInvitations(ctx, tx, id); err != nil {
+			return err
+		}
+
+		return s.delete(ctx, tx, id)
+	})
+}
+
+func (s *UsersStore) delete(ctx context.Context, tx *sql.Tx, id int64) error {
+	query := "DELETE FROM users WHERE id = $1"
+
+	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, id)
+	return err
+}
+
+// Update saves the profile fields of the user. A change of username is
+// recorded so the cooldown can be enforced, and ErrDuplicateUsername is
+// returned when the new username is taken.
+func (s *UsersStore) Update(ctx context.Context, user *User) error {
+	query := `
+		UPDATE users SET
+			username_changed_at = CASE WHEN username <> $1 THEN NOW() ELSE username_changed_at END,
+			username = $1, display_name = $2, bio = $3, location = $4, website = $5, avatar_url = $6,
+			updated_at = NOW()
+		WHERE id = $7
+		RETURNING updated_at, username_changed_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query,
+		user.Username,
+		user.DisplayName,
+		user.Bio,
+		user.Location,
+		user.Website,
+		user.AvatarURL,
+		user.ID,
+	).Scan(&user.UpdatedAt, &user.UsernameChangedAt)
+	if err != nil {
+		var pqErr *pq.Error
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNotFound
+		case errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "users_username_key":
+			return ErrDuplicateUsername
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SetPrivate switches the account between private and public. Going public
+// approves the pending follow requests in the same transaction.
+func (s *UsersStore) SetPrivate(ctx context.Context, id int64, isPrivate bool) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, DatabaseQueryTimeout)
+		defer cancel()
+
+		res, err := tx.ExecContext(ctx, "UPDATE users SET is_private = $1, updated_at = NOW() WHERE id = $2", isPrivate, id)
+		if err != nil {
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return ErrNotFound
+		}
+
+		if isPrivate {
+			return nil
+		}
+
+		return approveFollowRequests(ctx, tx, id)
+	})
+}
+
+// approveFollowRequests turns every pending request to follow userID into a
+// follow, since a public account has nothing left to approve.
+func approveFollowRequests(ctx context.Context, tx *sql.Tx, userID int64) error {
+	rows, err := tx.QueryContext(ctx, `
+		WITH approved AS (DELETE FROM follow_requests WHERE user_id = $1 RETURNING requester_id)
+		SELECT a.requester_id FROM approved a
+		WHERE NOT EXISTS (SELECT 1 FROM followers f WHERE f.user_id = $1 AND f.follower_id = a.requester_id)
+	`, userID)
+	if err != nil {
+		return err
+	}
+
+	var requesters []int64
+	for rows.Next() {
+		var requesterID int64
+		if err := rows.Scan(&requesterID); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		requesters = append(requesters, requesterID)
+	}
+	if err := rows.Err(); err != nil {
+		_ = rows.Close()
+		return err
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+
+	for _, requesterID := range requesters {
+		if err := follow(ctx, tx, requesterID, userID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
 
+func hashToken(token string) []byte {
+	hash := sha256.Sum256([]byte(token))
+	return hash[:]
 }